@@ -0,0 +1,121 @@
+// Copyright 2014 The Gman Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in LICENSE file.
+
+package main
+
+import (
+    "errors"  // for reporting errors
+    "fmt"     // for formatting results
+    "mandown" // for finding the title heading
+    "regexp"  // for matching apropos expressions
+    "sort"    // for ordering results
+    "strings" // for string manipulation
+)
+
+// pageSummary is a page with its description and the tags and aliases from
+// its front matter.
+type pageSummary struct {
+    pageRef
+    description string
+    tags        []string
+    aliases     []string
+}
+
+// line formats the summary like apropos(1) and whatis(1) do. Pages for
+// another os than the running one are marked with it.
+func (s pageSummary) line(primaryOS string) string {
+    name := s.name + "(" + s.section + ")"
+    if s.os != primaryOS {
+        name += " [" + s.os + "]"
+    }
+    return fmt.Sprintf("%s - %s", name, s.description)
+}
+
+// pageDescription returns the description of a page: the one in its front
+// matter or else the one from its title heading, the first heading in the
+// body. A title without the "name(section) - " part is used as a whole.
+func pageDescription(meta mandown.Meta, body []byte) string {
+    if meta.Description != "" {
+        return meta.Description
+    }
+    headings := mandown.Parse(body).Headings()
+    if len(headings) == 0 {
+        return ""
+    }
+    title := headings[0].Title
+    if _, _, description, ok := mandown.ParseTitle(title); ok {
+        return description
+    }
+    return title
+}
+
+// apropos returns the summaries whose name, aliases, description or tags
+// match expr, ignoring case. Results are ordered by relevance: an exact name
+// match first, then names starting with a match, other name matches and
+// finally description and tag matches. Aliases rank as names do.
+func apropos(summaries []pageSummary, expr string) ([]pageSummary, error) {
+    re, err := regexp.Compile("(?i)" + expr)
+    if err != nil {
+        return nil, errors.New("gman: bad apropos regex: " + err.Error())
+    }
+
+    nameRank := func(name string) int {
+        loc := re.FindStringIndex(name)
+        switch {
+        case loc == nil:
+            return -1
+        case loc[0] == 0 && loc[1] == len(name):
+            return 0
+        case loc[0] == 0:
+            return 1
+        }
+        return 2
+    }
+    rank := func(s pageSummary) int {
+        best := nameRank(s.name)
+        for _, alias := range s.aliases {
+            if r := nameRank(alias); r >= 0 && (best < 0 || r < best) {
+                best = r
+            }
+        }
+        if best >= 0 {
+            return best
+        }
+        if re.MatchString(s.description) {
+            return 3
+        }
+        for _, tag := range s.tags {
+            if re.MatchString(tag) {
+                return 3
+            }
+        }
+        return -1
+    }
+
+    type match struct {
+        pageSummary
+        rank int
+    }
+    var matches []match
+    for _, s := range summaries {
+        if r := rank(s); r >= 0 {
+            matches = append(matches, match{s, r})
+        }
+    }
+    sort.SliceStable(matches, func(i, j int) bool {
+        a, b := matches[i], matches[j]
+        if a.rank != b.rank {
+            return a.rank < b.rank
+        }
+        if a.name != b.name {
+            return strings.ToLower(a.name) < strings.ToLower(b.name)
+        }
+        return a.section < b.section
+    })
+    var result []pageSummary
+    for _, m := range matches {
+        result = append(result, m.pageSummary)
+    }
+    return result, nil
+}
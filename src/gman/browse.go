@@ -0,0 +1,223 @@
+// Copyright 2014 The Gman Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in LICENSE file.
+
+package main
+
+import (
+    "bytes"                            // for serving files
+    "fmt"                              // for writing the page list
+    "github.com/grymoire7/blackfriday" // markdown parser
+    "html"                             // for escaping page names
+    "io"                               // for serving files
+    "log"                              // for debug logging
+    "mandown"                          // for page front matter and titles
+    "net"                              // for the browse address
+    "net/http"                         // for the browse server
+    "path"                             // for cleaning request paths
+    "path/filepath"                    // for building page paths
+    "strings"                          // for string manipulation
+    "time"                             // for serving files
+)
+
+// defaultPort is the port the browse server listens on when none is given.
+const defaultPort = "8088"
+
+// browseHost is the address the browse server listens on. Only this machine
+// may connect, since every page root is served.
+const browseHost = "localhost"
+
+// browse serves the library over HTTP on port of browseHost until it fails. URLs follow
+// the page root layout, so /linux/en/gman1/gman.1.md shows that page and
+// the images it refers to by relative name are found next to it, whether
+// the root is a directory or a help pack. The first root holding a file
+// wins.
+func (lib *library) browse(port string) error {
+    http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+        rel := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+        if rel == "" {
+            lib.servePageList(w)
+            return
+        }
+        for _, root := range lib.roots {
+            p := filepath.Join(root, filepath.FromSlash(rel))
+            if !lib.isFile(p) {
+                continue
+            }
+            section := strings.TrimPrefix(path.Base(path.Dir(rel)), "gman")
+            if name, ok := pageFileName(path.Base(rel), section); ok && isSection(section) {
+                lib.servePage(w, r, pageRef{name: name, section: section, path: p})
+            } else {
+                lib.serveFile(w, r, p)
+            }
+            return
+        }
+        http.NotFound(w, r)
+    })
+    addr := net.JoinHostPort(browseHost, port)
+    log.Println("Browsing on", addr)
+    return http.ListenAndServe(addr, nil)
+}
+
+// servePageList writes links to the pages lookup would show, by name.
+func (lib *library) servePageList(w http.ResponseWriter) {
+    fmt.Fprintln(w, "<!DOCTYPE html>\n<html><head><title>gman</title></head><body><ul>")
+    seen := make(map[string]bool)
+    for _, ref := range lib.allPages() {
+        if !contains(lib.v.oses, ref.os) || !contains(lib.v.langs, ref.lang) || !lib.applyFrontMatter(&ref) {
+            continue
+        }
+        key := ref.name + "(" + ref.section + ")"
+        if seen[key] {
+            continue
+        }
+        best, err := lib.lookup(ref.name, ref.section, false)
+        if err != nil {
+            continue
+        }
+        seen[key] = true
+        fmt.Fprintf(w, "<li><a href=\"/%s\">%s</a></li>\n",
+            html.EscapeString(lib.relPath(best[0].path)), html.EscapeString(key))
+    }
+    fmt.Fprintln(w, "</ul></body></html>")
+}
+
+// servePage writes the page as HTML. Its front matter supplies the meta
+// tags of the head and a footer with the page's details. A redirect stub
+// sends the browser to the page it leads to.
+func (lib *library) servePage(w http.ResponseWriter, r *http.Request, ref pageRef) {
+    target, err := lib.follow(ref)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if target.path != ref.path {
+        http.Redirect(w, r, "/"+lib.relPath(target.path), http.StatusFound)
+        return
+    }
+    input, err := lib.readPage(target)
+    if err != nil {
+        http.Error(w, readError(ref, err), http.StatusInternalServerError)
+        return
+    }
+    meta, body := splitPage(ref, input)
+    w.Header().Set("Content-Type", "text/html; charset=utf-8")
+    err = lib.writeHTML(w, []outputPage{{ref, meta, body}}, func(ref pageRef) string {
+        return "/" + lib.relPath(ref.path)
+    })
+    if err != nil {
+        log.Println("Error serving", ref.path, ":", err)
+    }
+}
+
+// writeHTML writes pages as a standalone HTML document. The front matter of
+// the first page supplies the meta tags of the head, and each page ends with
+// a footer of its details. The related pages in a footer are linked to the
+// URL href gives, if href is not nil. Code blocks are highlighted as they
+// are in the terminal.
+//
+// Unlike the other formats, HTML is rendered by blackfriday rather than from
+// the mandown tree: mandown keeps only what the terminal, roff and JSON can
+// show, dropping markup nested in emphasis and links and inline HTML, all of
+// which a browser shows.
+func (lib *library) writeHTML(w io.Writer, pages []outputPage, href func(pageRef) string) error {
+    // Write the document whole so that a failed write is one error.
+    var buf bytes.Buffer
+    extensions := 0
+    extensions |= blackfriday.EXTENSION_NO_INTRA_EMPHASIS
+    extensions |= blackfriday.EXTENSION_TABLES
+    extensions |= blackfriday.EXTENSION_FENCED_CODE
+    extensions |= blackfriday.EXTENSION_AUTOLINK
+
+    var names []string
+    for _, p := range pages {
+        names = append(names, p.ref.name+"("+p.ref.section+")")
+    }
+    first := pages[0]
+    fmt.Fprintf(&buf, "<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\">\n<title>%s</title>\n",
+        html.EscapeString(strings.Join(names, ", ")))
+    writeMetaTag(&buf, "description", pageDescription(first.meta, first.body))
+    writeMetaTag(&buf, "keywords", strings.Join(first.meta.Tags, ", "))
+    writeMetaTag(&buf, "author", strings.Join(first.meta.Authors, ", "))
+    fmt.Fprintln(&buf, highlightStyle)
+    fmt.Fprintln(&buf, "</head><body>")
+    for i, p := range pages {
+        if i > 0 {
+            fmt.Fprintln(&buf, "<hr>")
+        }
+        buf.Write(blackfriday.Markdown(p.body, newHTMLRenderer(p.body), extensions))
+        lib.writeMetaFooter(&buf, p.meta, href)
+    }
+    fmt.Fprintln(&buf, "</body></html>")
+    _, err := w.Write(buf.Bytes())
+    return err
+}
+
+// writeMetaTag writes a meta tag to the head of a page unless content is
+// empty.
+func writeMetaTag(w io.Writer, name, content string) {
+    if content != "" {
+        fmt.Fprintf(w, "<meta name=\"%s\" content=\"%s\">\n", name, html.EscapeString(content))
+    }
+}
+
+// writeMetaFooter writes the front matter details of a page: the tool
+// version, authors, review date and related pages, linked where they are in
+// the library and href is not nil.
+func (lib *library) writeMetaFooter(w io.Writer, meta mandown.Meta, href func(pageRef) string) {
+    var items []string
+    add := func(label, value string) {
+        if value != "" {
+            items = append(items, "<dt>"+label+"</dt><dd>"+value+"</dd>")
+        }
+    }
+    add("Version", html.EscapeString(meta.Version))
+    add("Authors", html.EscapeString(strings.Join(meta.Authors, ", ")))
+    add("Last reviewed", html.EscapeString(meta.Reviewed))
+    var links []string
+    for _, see := range meta.SeeAlso {
+        link := html.EscapeString(see)
+        name, section := see, ""
+        if n, s, _, ok := mandown.ParseTitle(see); ok {
+            name, section = n, s
+        }
+        if refs, err := lib.lookup(name, section, false); err == nil && href != nil {
+            link = "<a href=\"" + html.EscapeString(href(refs[0])) + "\">" + link + "</a>"
+        }
+        links = append(links, link)
+    }
+    add("See also", strings.Join(links, ", "))
+    if len(items) > 0 {
+        fmt.Fprintf(w, "<hr>\n<dl class=\"gman-meta\">\n%s\n</dl>\n", strings.Join(items, "\n"))
+    }
+}
+
+// serveFile writes any other file, such as an image, as it is.
+func (lib *library) serveFile(w http.ResponseWriter, r *http.Request, p string) {
+    f, err := lib.open(p)
+    if err != nil {
+        http.NotFound(w, r)
+        return
+    }
+    defer f.Close()
+    data, err := io.ReadAll(f)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        return
+    }
+    var modTime time.Time
+    if fi, err := f.Stat(); err == nil {
+        modTime = fi.ModTime()
+    }
+    http.ServeContent(w, r, p, modTime, bytes.NewReader(data))
+}
+
+// relPath returns path relative to the root holding it, with slashes.
+func (lib *library) relPath(p string) string {
+    for _, root := range lib.roots {
+        if strings.HasPrefix(p, root+string(filepath.Separator)) {
+            return filepath.ToSlash(p[len(root)+1:])
+        }
+    }
+    return filepath.ToSlash(p)
+}
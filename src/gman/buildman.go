@@ -0,0 +1,134 @@
+// Copyright 2014 The Gman Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in LICENSE file.
+
+package main
+
+import (
+    "bytes"         // for buffering man pages
+    "errors"        // for read errors
+    "fmt"           // for reporting errors
+    "log"           // for debug logging
+    "mandown"       // for parsing pages
+    "md2man"        // for converting pages to roff
+    "os"            // for writing man pages
+    "path/filepath" // for building man page paths
+)
+
+// defaultManDir is where build-man writes man pages when no directory is
+// given.
+const defaultManDir = "man"
+
+// roffHeader returns the .TH line details of a page: the date it was last
+// reviewed, or else last changed, and the version of the tool documented.
+func (lib *library) roffHeader(p outputPage) md2man.Header {
+    h := md2man.Header{Name: p.ref.name, Section: p.ref.section, Date: p.meta.Reviewed}
+    if h.Date == "" && p.ref.source == "" {
+        if fi, err := lib.stat(p.ref.path); err == nil && !fi.ModTime().IsZero() {
+            h.Date = fi.ModTime().Format("2006-01-02")
+        }
+    }
+    if p.meta.Version != "" {
+        h.Source = p.ref.name + " " + p.meta.Version
+    }
+    return h
+}
+
+// manPageFile returns where a page goes under dir: dir/man1/gzip.1 for
+// gzip(1).
+func manPageFile(dir, name, section string) string {
+    return filepath.Join(dir, "man"+section, name+"."+section)
+}
+
+// buildMan writes pages as man pages under dir, in the layout man(1)
+// searches. Without names every page shown for the configured os and lang
+// is written. A redirect stub, and each alias in a page's front matter,
+// becomes a ".so" link to the page it leads to, unless a page of that name
+// is written. It returns the files written and the pages that could not be.
+func (lib *library) buildMan(dir string, names []string) ([]string, []error) {
+    var files []string
+    var errs []error
+    written := make(map[string]bool)
+    write := func(file string, data []byte) {
+        if written[file] {
+            return
+        }
+        written[file] = true
+        err := os.MkdirAll(filepath.Dir(file), 0755)
+        if err == nil {
+            err = os.WriteFile(file, data, 0644)
+        }
+        if err != nil {
+            errs = append(errs, err)
+            return
+        }
+        log.Println("Wrote", file)
+        files = append(files, file)
+    }
+    type soLink struct {
+        name, section string
+        target        pageRef
+    }
+    var links []soLink
+
+    var refs []pageRef
+    if len(names) == 0 {
+        seen := make(map[string]bool)
+        for _, ref := range lib.allPages() {
+            // Pages are listed by directory; their front matter may move
+            // them to another section or leave them out for this os.
+            if !contains(lib.v.oses, ref.os) || !contains(lib.v.langs, ref.lang) || !lib.applyFrontMatter(&ref) {
+                continue
+            }
+            key := ref.name + "(" + ref.section + ")"
+            if seen[key] {
+                continue
+            }
+            seen[key] = true
+            refs = append(refs, ref)
+        }
+    } else {
+        for _, name := range names {
+            found, err := lib.findPages(name, "", false)
+            if err != nil {
+                errs = append(errs, fmt.Errorf("gman: help page %s not found", name))
+                continue
+            }
+            refs = append(refs, found...)
+        }
+    }
+
+    for _, ref := range refs {
+        best, err := lib.lookup(ref.name, ref.section, false)
+        if err != nil {
+            errs = append(errs, err)
+            continue
+        }
+        target := best[0]
+        if target.redirectedFrom != "" {
+            links = append(links, soLink{ref.name, ref.section, target})
+            continue
+        }
+        input, err := lib.readPage(target)
+        if err != nil {
+            errs = append(errs, errors.New(readError(target, err)))
+            continue
+        }
+        meta, body := splitPage(target, input)
+        var out bytes.Buffer
+        page := outputPage{target, meta, body}
+        if err := md2man.Write(&out, mandown.Parse(body), lib.roffHeader(page)); err != nil {
+            errs = append(errs, err)
+            continue
+        }
+        write(manPageFile(dir, target.name, target.section), out.Bytes())
+        for _, alias := range meta.Aliases {
+            links = append(links, soLink{alias, target.section, target})
+        }
+    }
+    for _, l := range links {
+        so := filepath.ToSlash(filepath.Join("man"+l.target.section, l.target.name+"."+l.target.section))
+        write(manPageFile(dir, l.name, l.section), []byte(".so "+so+"\n"))
+    }
+    return files, errs
+}
@@ -0,0 +1,283 @@
+// Copyright 2014 The Gman Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in LICENSE file.
+
+package main
+
+import (
+    "fmt"     // for reporting bad styles
+    "os"      // for reading the environment
+    "sort"    // for listing theme names
+    "strconv" // for parsing color numbers
+    "strings" // for string manipulation
+)
+
+// defaultTheme is the theme used when the config names none.
+const defaultTheme = "dark"
+
+// elementNames are the names of the elements a theme styles.
+var elementNames = map[string]element{
+    "h1":       h1Element,
+    "h2":       h2Element,
+    "h3":       h3Element,
+    "h4":       h4Element,
+    "strong":   strongElement,
+    "emphasis": emphasisElement,
+    "code":     codeElement,
+    "option":   optionElement,
+    "link":     linkElement,
+    "quote":    quoteElement,
+    "comment":  commentElement,
+    "keyword":  keywordElement,
+    "string":   stringElement,
+    "number":   numberElement,
+    "variable": variableElement,
+    "command":  commandElement,
+    "operator": operatorElement,
+    "key":      keyElement,
+    "builtin":  builtinElement,
+    "inserted": insertedElement,
+    "deleted":  deletedElement,
+    "meta":     metaElement,
+}
+
+// builtinThemes are the themes that may be named in the config. Dark and
+// light suit terminals with those backgrounds; mono uses no color at all.
+var builtinThemes = map[string]map[string]string{
+    "dark": {
+        "h1":       "bold 214",
+        "h2":       "bold 75",
+        "h3":       "bold 114",
+        "h4":       "bold",
+        "strong":   "bold",
+        "emphasis": "italic",
+        "code":     "150",
+        "option":   "bold 81",
+        "link":     "underline 75",
+        "quote":    "245",
+        "comment":  "italic 244",
+        "keyword":  "170",
+        "string":   "179",
+        "number":   "141",
+        "variable": "117",
+        "command":  "bold",
+        "operator": "170",
+        "key":      "75",
+        "builtin":  "80",
+        "inserted": "green",
+        "deleted":  "red",
+        "meta":     "bold 75",
+    },
+    "light": {
+        "h1":       "bold 130",
+        "h2":       "bold 25",
+        "h3":       "bold 28",
+        "h4":       "bold",
+        "strong":   "bold",
+        "emphasis": "italic",
+        "code":     "88",
+        "option":   "bold 30",
+        "link":     "underline 25",
+        "quote":    "242",
+        "comment":  "italic 244",
+        "keyword":  "90",
+        "string":   "94",
+        "number":   "55",
+        "variable": "25",
+        "command":  "bold",
+        "operator": "90",
+        "key":      "25",
+        "builtin":  "30",
+        "inserted": "28",
+        "deleted":  "124",
+        "meta":     "bold 25",
+    },
+    "mono": {
+        "h1":       "bold",
+        "h2":       "bold",
+        "h3":       "bold",
+        "h4":       "bold",
+        "strong":   "bold",
+        "emphasis": "underline",
+        "code":     "bold",
+        "option":   "bold",
+        "link":     "underline",
+        "comment":  "dim",
+        "keyword":  "bold",
+        "command":  "bold",
+        "inserted": "bold",
+        "deleted":  "dim",
+        "meta":     "bold",
+    },
+}
+
+// attributes are the SGR parameters of the text attributes a style may
+// name.
+var attributes = map[string]string{
+    "bold":      "1",
+    "dim":       "2",
+    "italic":    "3",
+    "underline": "4",
+    "blink":     "5",
+    "reverse":   "7",
+}
+
+// colorNames are the eight basic colors, numbered as in SGR parameters.
+var colorNames = []string{"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+
+// theme maps the elements of terminal output to SGR parameters, such as
+// "1;38;5;214" for bold orange.
+type theme map[element]string
+
+// style styles a word for the terminal.
+func (t theme) style(e element, text string) string {
+    if sgr := t[e]; sgr != "" {
+        return "\x1b[" + sgr + "m" + text + "\x1b[0m"
+    }
+    return text
+}
+
+// useColor reports whether terminal output is styled. The --color option or
+// the "color" config key says always, never or auto. Auto, the default,
+// styles output to a terminal, which the pager writes to as well, unless
+// the NO_COLOR environment variable is set; CLICOLOR_FORCE styles output
+// that is not to a terminal.
+func useColor(opts map[string]interface{}) (bool, error) {
+    when, _ := opts["--color"].(string)
+    if when == "" {
+        when, _ = opts["color"].(string)
+    }
+    switch when {
+    case "always":
+        return true, nil
+    case "never":
+        return false, nil
+    case "", "auto":
+        if os.Getenv("NO_COLOR") != "" {
+            return false, nil
+        }
+        if force := os.Getenv("CLICOLOR_FORCE"); force != "" && force != "0" {
+            return true, nil
+        }
+        return isTerminal(os.Stdout), nil
+    }
+    return false, fmt.Errorf("gman: unknown color mode %s; use auto, always or never", when)
+}
+
+// loadTheme returns the theme the "theme" config key gives: the name of a
+// built-in theme, or an object of styles by element name that change the
+// built-in theme named by its "base" key, such as
+//
+//	{"base": "light", "h1": "bold #d75f00", "code": "on 254"}
+func loadTheme(opts map[string]interface{}) (theme, error) {
+    base := ""
+    var styles map[string]interface{}
+    switch v := opts["theme"].(type) {
+    case string:
+        base = v
+    case map[string]interface{}:
+        base, _ = v["base"].(string)
+        styles = v
+    }
+    if base == "" {
+        base = defaultTheme
+    }
+    builtin, ok := builtinThemes[base]
+    if !ok {
+        var names []string
+        for name := range builtinThemes {
+            names = append(names, name)
+        }
+        sort.Strings(names)
+        return nil, fmt.Errorf("gman: unknown theme %s; use %s", base, strings.Join(names, ", "))
+    }
+
+    t := make(theme)
+    set := func(name, spec string) error {
+        e, ok := elementNames[name]
+        if !ok {
+            return fmt.Errorf("gman: theme has unknown element %s", name)
+        }
+        sgr, err := parseStyle(spec)
+        if err != nil {
+            return fmt.Errorf("gman: theme style for %s: %v", name, err)
+        }
+        t[e] = sgr
+        return nil
+    }
+    for name, spec := range builtin {
+        if err := set(name, spec); err != nil {
+            return nil, err
+        }
+    }
+    for name, v := range styles {
+        if name == "base" || strings.HasPrefix(name, "_") {
+            continue
+        }
+        spec, ok := v.(string)
+        if !ok {
+            return nil, fmt.Errorf("gman: theme style for %s is not a string", name)
+        }
+        if err := set(name, spec); err != nil {
+            return nil, err
+        }
+    }
+    return t, nil
+}
+
+// parseStyle converts a style such as "bold underline 208 on #303030" to
+// SGR parameters. A style lists attributes (bold, dim, italic, underline,
+// blink, reverse) and a foreground color, and "on" a background color.
+// Colors are basic names such as red or bright-red, 256-color palette
+// numbers or "#rrggbb" true colors.
+func parseStyle(spec string) (string, error) {
+    var params []string
+    background := false
+    for _, word := range strings.Fields(strings.ToLower(spec)) {
+        if word == "on" {
+            background = true
+            continue
+        }
+        if attr, ok := attributes[word]; ok && !background {
+            params = append(params, attr)
+            continue
+        }
+        color, err := colorParam(word, background)
+        if err != nil {
+            return "", err
+        }
+        params = append(params, color)
+        background = false
+    }
+    if background {
+        return "", fmt.Errorf("%q: no color after \"on\"", spec)
+    }
+    return strings.Join(params, ";"), nil
+}
+
+// colorParam returns the SGR parameters that set a foreground or
+// background color.
+func colorParam(color string, background bool) (string, error) {
+    base, extended := 30, "38"
+    if background {
+        base, extended = 40, "48"
+    }
+    name := strings.TrimPrefix(color, "bright-")
+    for i, c := range colorNames {
+        if c == name {
+            if name != color {
+                base += 60
+            }
+            return strconv.Itoa(base + i), nil
+        }
+    }
+    if n, err := strconv.Atoi(color); err == nil && n >= 0 && n <= 255 {
+        return extended + ";5;" + color, nil
+    }
+    if len(color) == 7 && color[0] == '#' {
+        if rgb, err := strconv.ParseUint(color[1:], 16, 32); err == nil {
+            return fmt.Sprintf("%s;2;%d;%d;%d", extended, rgb>>16, rgb>>8&0xff, rgb&0xff), nil
+        }
+    }
+    return "", fmt.Errorf("unknown color or attribute %q", color)
+}
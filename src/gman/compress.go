@@ -0,0 +1,93 @@
+// Copyright 2014 The Gman Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in LICENSE file.
+
+package main
+
+import (
+    "compress/bzip2" // for bzip2 io
+    "compress/gzip"  // for gzip io
+    "fmt"            // for formatting errors
+    "io"             // for decompressing pages
+    "strings"        // for string manipulation
+)
+
+// decompressor returns a reader of the decompressed contents of r.
+type decompressor func(r io.Reader) (io.Reader, error)
+
+// decompressors maps a file extension to the decompressor for it, and
+// compressedExts is the order lookup tries the extensions in. Use
+// registerDecompressor to add formats.
+var (
+    decompressors  = make(map[string]decompressor)
+    compressedExts []string
+)
+
+func init() {
+    registerDecompressor(".gz", func(r io.Reader) (io.Reader, error) {
+        return gzip.NewReader(r)
+    })
+    registerDecompressor(".bz2", func(r io.Reader) (io.Reader, error) {
+        return bzip2.NewReader(r), nil
+    })
+}
+
+// registerDecompressor makes pages ending in ext readable with d. Formats
+// registered later are tried after earlier ones.
+func registerDecompressor(ext string, d decompressor) {
+    if _, ok := decompressors[ext]; !ok {
+        compressedExts = append(compressedExts, ext)
+    }
+    decompressors[ext] = d
+}
+
+// compressionExt returns the registered extension path ends in, or the
+// empty string for an uncompressed file.
+func compressionExt(path string) string {
+    for _, ext := range compressedExts {
+        if strings.HasSuffix(path, ext) {
+            return ext
+        }
+    }
+    return ""
+}
+
+// pageFileNames returns the file names a page may have in section, in the
+// order lookup tries them: compressed pages first, both the "gman.1.md.gz"
+// form that compressing "gman.1.md" gives and the older "gman.1.gz" form,
+// then the plain page.
+func pageFileNames(name, section string) []string {
+    base := name + "." + section
+    var names []string
+    for _, ext := range compressedExts {
+        names = append(names, base+".md"+ext, base+ext)
+    }
+    return append(names, base+".md")
+}
+
+// corruptPageError reports a page that exists but cannot be decompressed.
+type corruptPageError struct {
+    path string
+    err  error
+}
+
+func (e *corruptPageError) Error() string {
+    return fmt.Sprintf("corrupt archive %s: %v", e.path, e.err)
+}
+
+// decompress returns the decompressed contents of r, which was read from a
+// file at path ending in ext.
+func decompress(r io.Reader, path, ext string) ([]byte, error) {
+    dr, err := decompressors[ext](r)
+    if err != nil {
+        return nil, &corruptPageError{path, err}
+    }
+    if c, ok := dr.(io.Closer); ok {
+        defer c.Close()
+    }
+    input, err := io.ReadAll(dr)
+    if err != nil {
+        return nil, &corruptPageError{path, err}
+    }
+    return input, nil
+}
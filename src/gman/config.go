@@ -44,18 +44,55 @@ func readConfig() map[string]interface{} {
     usage := `GMan
 
 Usage:
-  gman [-d | --debug] [--color] [-s <docsection>]
-       [-P pager | --pager=pager] <page>
+  gman [-d | --debug] build-man [-o <dir>] [<page>...]
+  gman [-d | --debug] [--color <when>] [-a | --all] [-s <docsection>]...
+       [--section-regex <regex>]... [--exact] [-i | --ignore-case]
+       [-P pager | --pager=pager] [-q <source>] [--save]
+       [--format <format>] [--width <columns>] <page>...
+  gman [-d | --debug] --toc [--json] <page>...
+  gman [-d | --debug] (-k <regex> | --apropos <regex>)
+  gman [-d | --debug] (-f | --whatis) <page>...
+  gman [-d | --debug] [--color <when>] (-K | --search) <term>...
+  gman [-d | --debug] --update-index
+  gman [-d | --debug] --complete <prefix>
+  gman --path
   gman (-b | --browse) [(-p <port> | --port <port>)]
   gman (-h | --help | -V | --version )
 
+A page may be preceded by its section, as in "gman 7 gman-mandown".
+
 Options:
   -h --help                   Show this help.
   -d --debug                  Print debug information.
-  --color                     Use color text in terminal.
-  -s <docsection>             Print document section.
+  --color <when>              Color the page: auto, always or never.
+  -a --all                    Show the page from every section it is in.
+  -s <docsection> --section <docsection>
+                              Print document section. A heading path such as
+                              Options/-b picks a heading under a parent.
+  --section-regex <regex>     Print document sections matching regex.
+  --exact                     Section headings must match exactly.
+  -i --ignore-case            Ignore case when matching section headings.
   -P <pager> --pager <pager>  Specifiy the pager [default: less]
+  -b --browse                 Serve the pages over HTTP for a web browser.
   -p <port> --port <port>     Specifiy port for web server.
+  -q <source> --query <source>
+                              Only read gman pages, system man pages or
+                              pages made from a command's --help output.
+  --save                      Save a page made from --help output.
+  --format <format>           Output format: term, text, html, roff, md or
+                              json.
+  --width <columns>           Fill text to this many columns instead of the
+                              width of the terminal.
+  -k <regex> --apropos <regex>
+                              Search page names and descriptions.
+  -f --whatis                 Print the one-line description of each page.
+  -K --search                 Search the text of all pages for the terms.
+  --update-index              Bring the page index up to date.
+  --complete <prefix>         List page names starting with prefix.
+  --path                      Print the page search path.
+  -o <dir> --output <dir>     Directory build-man writes man pages to.
+  --toc                       Print the page's headings and their anchors.
+  --json                      Print the headings as JSON.
   -V --version                Show version.`
 
     // get user directory
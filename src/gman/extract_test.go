@@ -0,0 +1,136 @@
+package main
+
+import (
+    "mandown"
+    "strings"
+    "testing"
+)
+
+// headingTitles returns the titles of the headings in input, joined by "|".
+func headingTitles(input []byte) string {
+    var titles []string
+    for _, h := range mandown.Parse(input).Headings() {
+        titles = append(titles, h.Title)
+    }
+    return strings.Join(titles, "|")
+}
+
+func TestExtract_Options(t *testing.T) {
+    page := "# tool(1)\n\n## Options\n\n#### -a, --all\nAll.\n\n" +
+        "#### -o *file*, --output=*file*\nOutput.\n\n#### -v\nVerbose.\n\n## Files\nNone.\n"
+    noOptions := "# tool(1)\n\nNo options here.\n"
+    subcommand := "## commit\nRecord.\n\n#### -m *msg*\nMessage.\n"
+
+    tests := []struct {
+        page    string
+        args    string
+        want    string // entry headings shown, or "" for an error
+        missing string
+    }{
+        // Entries are shown in command-line order.
+        {page, "-v -a", "-v|-a, --all", ""},
+        {page, "--all", "-a, --all", ""},
+        // Combined flags are split; the rest of the word after a flag with
+        // an argument is the argument.
+        {page, "-av", "-a, --all|-v", ""},
+        {page, "-ofile.txt", "-o *file*, --output=*file*", ""},
+        {page, "--output=x", "-o *file*, --output=*file*", ""},
+        {page, "-a -a", "-a, --all", ""},
+        // Options without an entry are reported.
+        {page, "-a -z --nope", "-a, --all", "-z --nope"},
+        {page, "-z", "", "-z"},
+        // Operands and words after "--" are not options.
+        {page, "file -- -a", "", ""},
+        {noOptions, "-a", "", "-a"},
+        // Without an Options section, headings naming options are entries.
+        {subcommand, "-m", "-m *msg*", ""},
+    }
+    for _, tt := range tests {
+        out, missing, err := extractOptions([]byte(tt.page), strings.Fields(tt.args))
+        if got := strings.Join(missing, " "); got != tt.missing {
+            t.Errorf("extractOptions(%q) missing %q, want %q", tt.args, got, tt.missing)
+        }
+        if tt.want == "" {
+            if err == nil {
+                t.Errorf("extractOptions(%q) = %q, want no options found", tt.args, out)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("extractOptions(%q) returned error: %v", tt.args, err)
+            continue
+        }
+        if got := headingTitles(out); got != tt.want {
+            t.Errorf("extractOptions(%q) shows %q, want %q", tt.args, got, tt.want)
+        }
+    }
+}
+
+func TestExtract_Sections(t *testing.T) {
+    page := "# tool(1)\n\n## Summary of changes\nChanges.\n\n## Options\n\n#### -b, --browse\nBrowse.\n\n" +
+        "#### -a/b\nSlash.\n\n## Examples\n\n#### -b\nAn example.\n\n```\n# not a heading\n```\n\n" +
+        "Version 2\n=========\nSetext.\n"
+
+    tests := []struct {
+        selectors []sectionSelector
+        want      string // headings of the sections picked, or "" for an error
+        missing   string
+    }{
+        // Names match part of a heading, with case as given.
+        {[]sectionSelector{newPathSelector("Options", false, false)}, "Options|-b, --browse|-a/b", ""},
+        {[]sectionSelector{newPathSelector("options", false, false)}, "", "options"},
+        {[]sectionSelector{newPathSelector("options", false, true)}, "Options|-b, --browse|-a/b", ""},
+        // Exact names match whole headings only.
+        {[]sectionSelector{newPathSelector("Summary", true, false)}, "", "Summary"},
+        {[]sectionSelector{newPathSelector("summary of changes", true, true)}, "Summary of changes", ""},
+        // A path picks a heading nested under another; "\/" is a slash.
+        {[]sectionSelector{newPathSelector("Examples/-b", false, false)}, "-b", ""},
+        {[]sectionSelector{newPathSelector(`Options/-a\/b`, false, false)}, "-a/b", ""},
+        {[]sectionSelector{newPathSelector("Files/-b", false, false)}, "", "Files/-b"},
+        // A regex picks a numbered Setext heading; "#" inside code is not a heading.
+        {[]sectionSelector{mustRegexSelector(t, `\d$`)}, "Version 2", ""},
+        {[]sectionSelector{newPathSelector("not a heading", false, false)}, "", "not a heading"},
+        // Several selectors pick sections in document order, each once.
+        {[]sectionSelector{
+            newPathSelector("Examples", false, false),
+            newPathSelector("Summary", false, false),
+            newPathSelector("Examples/-b", false, false),
+            newPathSelector("Nothing", false, false),
+        }, "Summary of changes|Examples|-b", "Nothing"},
+    }
+    for _, tt := range tests {
+        var sources []string
+        for _, s := range tt.selectors {
+            sources = append(sources, s.source)
+        }
+        out, missing, err := extractDocSections([]byte(page), tt.selectors)
+        if got := strings.Join(missing, " "); got != tt.missing {
+            t.Errorf("extractDocSections(%q) missing %q, want %q", sources, got, tt.missing)
+        }
+        if tt.want == "" {
+            if err == nil {
+                t.Errorf("extractDocSections(%q) = %q, want not found", sources, out)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("extractDocSections(%q) returned error: %v", sources, err)
+            continue
+        }
+        if got := headingTitles(out); got != tt.want {
+            t.Errorf("extractDocSections(%q) picks %q, want %q", sources, got, tt.want)
+        }
+    }
+
+    if _, err := newRegexSelector("(", false); err == nil {
+        t.Error("newRegexSelector(\"(\") succeeded, want bad regex error")
+    }
+}
+
+func mustRegexSelector(t *testing.T, expr string) sectionSelector {
+    s, err := newRegexSelector(expr, false)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return s
+}
@@ -0,0 +1,177 @@
+// Copyright 2014 The Gman Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in LICENSE file.
+
+package main
+
+import (
+    "encoding/json" // for the json format
+    "fmt"           // for reporting errors
+    "io"            // for writing output
+    "mandown"       // for the page tree
+    "md2man"        // for the roff format
+    "strings"       // for string manipulation
+)
+
+// formats are the output formats of --format. The default, term, is the
+// only one shown through the pager.
+var formats = []string{"term", "text", "html", "roff", "md", "json"}
+
+// pageSeparator separates the pages shown with -a.
+const pageSeparator = "\n\n* * *\n\n"
+
+// outputPage is a page ready for output: its front matter and the part of
+// its source that was asked for.
+type outputPage struct {
+    ref  pageRef
+    meta mandown.Meta
+    body []byte
+}
+
+// outputFormat returns the format asked for with --format or the "format"
+// config key.
+func outputFormat(opts map[string]interface{}) (string, error) {
+    format, _ := opts["--format"].(string)
+    if format == "" {
+        format, _ = opts["format"].(string)
+    }
+    if format == "" {
+        return "term", nil
+    }
+    if !contains(formats, format) {
+        return "", fmt.Errorf("gman: unknown format %s; use %s", format, strings.Join(formats, ", "))
+    }
+    return format, nil
+}
+
+// writeFormat writes pages in a format other than term. Text is filled to
+// width columns.
+func (lib *library) writeFormat(w io.Writer, format string, pages []outputPage, width int) error {
+    switch format {
+    case "md":
+        var bodies []string
+        for _, p := range pages {
+            bodies = append(bodies, strings.TrimRight(string(p.body), "\n"))
+        }
+        _, err := io.WriteString(w, strings.Join(bodies, pageSeparator)+"\n")
+        return err
+    case "text":
+        return (&textLayout{width: width}).write(w, pages)
+    case "html":
+        return lib.writeHTML(w, pages, nil)
+    case "roff":
+        for _, p := range pages {
+            if err := md2man.Write(w, mandown.Parse(p.body), lib.roffHeader(p)); err != nil {
+                return err
+            }
+        }
+    case "json":
+        return writeJSON(w, pages)
+    }
+    return nil
+}
+
+// jsonPage is a page in the json format: its front matter and its tree of
+// sections. Text is given as inline Markdown.
+type jsonPage struct {
+    Name     string        `json:"name"`
+    Section  string        `json:"section"`
+    Path     string        `json:"path"`
+    Meta     mandown.Meta  `json:"meta"`
+    Content  []jsonBlock   `json:"content,omitempty"` // before the first heading
+    Sections []jsonSection `json:"sections"`
+}
+
+// jsonSection is a heading with the blocks and sections below it.
+type jsonSection struct {
+    Title    string        `json:"title"`
+    Level    int           `json:"level"`
+    Slug     string        `json:"slug"`
+    Content  []jsonBlock   `json:"content,omitempty"`
+    Sections []jsonSection `json:"sections,omitempty"`
+}
+
+// jsonBlock is a paragraph, code block, list, quote, table or rule. A
+// heading inside a list item or quote is a block of type "heading".
+type jsonBlock struct {
+    Type    string        `json:"type"`
+    Text    string        `json:"text,omitempty"`
+    Info    string        `json:"info,omitempty"`
+    Ordered bool          `json:"ordered,omitempty"`
+    Items   [][]jsonBlock `json:"items,omitempty"`
+    Content []jsonBlock   `json:"content,omitempty"`
+    Rows    [][]string    `json:"rows,omitempty"`
+}
+
+// writeJSON writes a page as a JSON object, or several as an array of them.
+func writeJSON(w io.Writer, pages []outputPage) error {
+    var result []jsonPage
+    for _, p := range pages {
+        root := mandown.Parse(p.body).Tree()
+        page := jsonPage{Name: p.ref.name, Section: p.ref.section, Path: p.ref.path, Meta: p.meta}
+        page.Content, page.Sections = jsonContent(root.Children)
+        if page.Sections == nil {
+            page.Sections = []jsonSection{}
+        }
+        result = append(result, page)
+    }
+    var out []byte
+    var err error
+    if len(result) == 1 {
+        out, err = json.MarshalIndent(result[0], "", "  ")
+    } else {
+        out, err = json.MarshalIndent(result, "", "  ")
+    }
+    if err != nil {
+        return err
+    }
+    _, err = fmt.Fprintf(w, "%s\n", out)
+    return err
+}
+
+// jsonContent splits the nodes of a section into its blocks and its
+// subsections.
+func jsonContent(nodes []*mandown.Node) ([]jsonBlock, []jsonSection) {
+    var blocks []jsonBlock
+    var sections []jsonSection
+    for _, n := range nodes {
+        if n.Kind != mandown.SectionNode {
+            blocks = append(blocks, jsonBlocks([]*mandown.Node{n})...)
+            continue
+        }
+        sec := jsonSection{Title: n.Title, Level: n.Level, Slug: n.Slug}
+        sec.Content, sec.Sections = jsonContent(n.Children)
+        sections = append(sections, sec)
+    }
+    return blocks, sections
+}
+
+// jsonBlocks converts nodes to blocks. A section, as found inside a list
+// item or quote, becomes a heading block followed by its contents.
+func jsonBlocks(nodes []*mandown.Node) []jsonBlock {
+    var blocks []jsonBlock
+    for _, n := range nodes {
+        switch n.Kind {
+        case mandown.SectionNode:
+            blocks = append(blocks, jsonBlock{Type: "heading", Text: n.Title})
+            blocks = append(blocks, jsonBlocks(n.Children)...)
+        case mandown.ParagraphNode:
+            blocks = append(blocks, jsonBlock{Type: "paragraph", Text: n.Text})
+        case mandown.CodeNode:
+            blocks = append(blocks, jsonBlock{Type: "code", Text: n.Text, Info: n.Info})
+        case mandown.ListNode:
+            list := jsonBlock{Type: "list", Ordered: n.Ordered}
+            for _, item := range n.Children {
+                list.Items = append(list.Items, jsonBlocks(item.Children))
+            }
+            blocks = append(blocks, list)
+        case mandown.QuoteNode:
+            blocks = append(blocks, jsonBlock{Type: "quote", Content: jsonBlocks(n.Children)})
+        case mandown.TableNode:
+            blocks = append(blocks, jsonBlock{Type: "table", Rows: n.Rows})
+        case mandown.RuleNode:
+            blocks = append(blocks, jsonBlock{Type: "rule"})
+        }
+    }
+    return blocks
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "mandown"
+    "os"
+    "strings"
+    "testing"
+)
+
+const formatInput = `# tool(1) -- does things
+
+## Options
+Use **tool** with [care](http://example.com).
+
+#### -a, --all
+Do all things:
+
+- hidden ones
+- others
+
+Like so:
+
+    tool -a
+`
+
+func TestFormat_Text(t *testing.T) {
+    var out bytes.Buffer
+    pages := []outputPage{{pageRef{name: "tool", section: "1"}, mandown.Meta{}, []byte(formatInput)}}
+    if err := (&textLayout{}).write(&out, pages); err != nil {
+        t.Fatal(err)
+    }
+    want := `tool(1) -- does things
+
+Options
+
+    Use tool with care <http://example.com>.
+
+    -a, --all
+
+        Do all things:
+
+        - hidden ones
+        - others
+
+        Like so:
+
+            tool -a
+`
+    if out.String() != want {
+        t.Errorf("text = \n%s\nwant\n%s", out.String(), want)
+    }
+}
+
+func TestFormat_JSON(t *testing.T) {
+    pages := []outputPage{{pageRef{name: "tool", section: "1"}, mandown.Meta{}, []byte(formatInput)}}
+    var out bytes.Buffer
+    if err := writeJSON(&out, pages); err != nil {
+        t.Fatal(err)
+    }
+    var page jsonPage
+    if err := json.Unmarshal(out.Bytes(), &page); err != nil {
+        t.Fatal("output is not a JSON page: ", err)
+    }
+    if len(page.Sections) != 1 || len(page.Sections[0].Sections) != 1 {
+        t.Fatalf("sections = %+v", page.Sections)
+    }
+    entry := page.Sections[0].Sections[0].Sections
+    if len(entry) != 1 || entry[0].Title != "-a, --all" || len(entry[0].Content) != 4 {
+        t.Fatalf("option entries = %+v", entry)
+    }
+    if list := entry[0].Content[1]; list.Type != "list" || len(list.Items) != 2 {
+        t.Errorf("list = %+v", list)
+    }
+
+    out.Reset()
+    writeJSON(&out, append(pages, pages[0]))
+    if !strings.HasPrefix(out.String(), "[") {
+        t.Errorf("several pages are not a JSON array: %.20s", out.String())
+    }
+}
+
+func TestFormat_Wrap(t *testing.T) {
+    input := `## Options
+#### -a
+All the things there are, and then some more of them.
+
+- A list item that goes on and on.
+
+> Quoted words that wrap.
+
+    code that is long and is not wrapped
+`
+    var out bytes.Buffer
+    pages := []outputPage{{pageRef{name: "tool", section: "1"}, mandown.Meta{}, []byte(input)}}
+    mono, err := loadTheme(map[string]interface{}{"theme": "mono"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    layout := &textLayout{width: 30, style: mono.style}
+    if err := layout.write(&out, pages); err != nil {
+        t.Fatal(err)
+    }
+    want := "\x1b[1mOptions\x1b[0m\n\n" +
+        "    \x1b[1m-a\x1b[0m\n\n" +
+        "        All the things there\n" +
+        "        are, and then some\n" +
+        "        more of them.\n\n" +
+        "        - A list item that\n" +
+        "          goes on and on.\n\n" +
+        "            Quoted words that\n" +
+        "            wrap.\n\n" +
+        "            code that is long and is not wrapped\n"
+    if out.String() != want {
+        t.Errorf("wrapped text = %q, want %q", out.String(), want)
+    }
+}
+
+func TestFormat_TextWidth(t *testing.T) {
+    tests := []struct {
+        text  string
+        width int
+    }{
+        {"abc", 3},
+        {"\x1b[1mbold\x1b[0m", 4},
+        {"日本語", 6},
+        {"\x1b[1m한글\x1b[0m", 4},
+        {"cafe\u0301", 4},
+        {"ok 🙂", 5},
+    }
+    for _, tt := range tests {
+        if got := textWidth(tt.text); got != tt.width {
+            t.Errorf("textWidth(%q) = %d, want %d", tt.text, got, tt.width)
+        }
+    }
+
+    // Wide words fill a line by their columns, not their runes.
+    got := wrap([]string{"日本語", "の", "文章"}, 8)
+    if want := []string{"日本語", "の 文章"}; strings.Join(got, "|") != strings.Join(want, "|") {
+        t.Errorf("wrap = %q, want %q", got, want)
+    }
+}
+
+func TestFormat_Colors(t *testing.T) {
+    for spec, want := range map[string]string{
+        "bold underline":    "1;4",
+        "208 on #303030":    "38;5;208;48;2;48;48;48",
+        "italic bright-red": "3;91",
+        "#FF8800 on blue":   "38;2;255;136;0;44",
+        "":                  "",
+    } {
+        got, err := parseStyle(spec)
+        if err != nil || got != want {
+            t.Errorf("parseStyle(%q) = %q, %v, want %q", spec, got, err, want)
+        }
+    }
+    for _, spec := range []string{"purple", "on", "300"} {
+        if _, err := parseStyle(spec); err == nil {
+            t.Errorf("parseStyle(%q) gave no error", spec)
+        }
+    }
+
+    th, err := loadTheme(map[string]interface{}{
+        "theme": map[string]interface{}{"base": "light", "code": "on 254"},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    if th[codeElement] != "48;5;254" || th[h1Element] != "1;38;5;130" {
+        t.Errorf("theme = %v", th)
+    }
+    if _, err := loadTheme(map[string]interface{}{"theme": "neon"}); err == nil {
+        t.Error("unknown theme gave no error")
+    }
+
+    os.Setenv("NO_COLOR", "1")
+    os.Setenv("CLICOLOR_FORCE", "1")
+    defer os.Unsetenv("NO_COLOR")
+    defer os.Unsetenv("CLICOLOR_FORCE")
+    if color, _ := useColor(map[string]interface{}{}); color {
+        t.Error("NO_COLOR did not turn color off")
+    }
+    if color, _ := useColor(map[string]interface{}{"--color": "always"}); !color {
+        t.Error("--color always did not turn color on")
+    }
+    os.Unsetenv("NO_COLOR")
+    if color, _ := useColor(map[string]interface{}{"color": "auto"}); !color {
+        t.Error("CLICOLOR_FORCE did not turn color on")
+    }
+}
+
+func TestFormat_Highlight(t *testing.T) {
+    input := "# tool(1) -- does things\n\n## Synopsis\n\n    tool [-a] <file>\n\n" +
+        "## Files\n\n```json\n{\"width\": 80}\n```\n\n```\nplain -a\n```\n"
+    pages := []outputPage{{pageRef{name: "tool", section: "1"}, mandown.Meta{}, []byte(input)}}
+
+    names := make(map[element]string)
+    for name, e := range elementNames {
+        names[e] = name
+    }
+    layout := &textLayout{style: func(e element, text string) string {
+        if e == plainElement {
+            return text
+        }
+        return "{" + names[e] + ":" + text + "}"
+    }}
+    var out bytes.Buffer
+    if err := layout.write(&out, pages); err != nil {
+        t.Fatal(err)
+    }
+    got := out.String()
+    for _, want := range []string{
+        "        {command:tool} [{option:-a}] <file>\n",
+        "        {{key:\"width\"}: {number:80}}\n",
+        "        plain -a\n",
+    } {
+        if !strings.Contains(got, want) {
+            t.Errorf("highlighted text lacks %q:\n%s", want, got)
+        }
+    }
+
+    out.Reset()
+    if err := (&library{}).writeFormat(&out, "html", pages, 0); err != nil {
+        t.Fatal(err)
+    }
+    got = out.String()
+    for _, want := range []string{
+        "<pre><code class=\"language-sh\"><span class=\"gman-command\">tool</span> [<span class=\"gman-option\">-a</span>]",
+        "<span class=\"gman-key\">&#34;width&#34;</span>",
+        "<pre><code>plain -a\n</code></pre>",
+    } {
+        if !strings.Contains(got, want) {
+            t.Errorf("highlighted HTML lacks %q:\n%s", want, got)
+        }
+    }
+}
+
+func TestFormat_HighlightSkippedLevels(t *testing.T) {
+    // Examples skips a level, so Files closes it rather than nesting in it.
+    input := "# tool(1)\n\n#### Examples\n\n    tool -a\n\n### Files\n\n    plain -a\n"
+    pages := []outputPage{{pageRef{name: "tool", section: "1"}, mandown.Meta{}, []byte(input)}}
+    var out bytes.Buffer
+    if err := (&library{}).writeFormat(&out, "html", pages, 0); err != nil {
+        t.Fatal(err)
+    }
+    got := out.String()
+    for _, want := range []string{
+        "<pre><code class=\"language-sh\"><span class=\"gman-command\">tool</span>",
+        "<pre><code>plain -a\n</code></pre>",
+    } {
+        if !strings.Contains(got, want) {
+            t.Errorf("highlighted HTML lacks %q:\n%s", want, got)
+        }
+    }
+}
+
+func TestFormat_TOCLines(t *testing.T) {
+    input := []byte("---\nname: tool\nsection: 1\n---\n\n# tool(1)\n\n## Options\n")
+    _, body := splitPage(pageRef{}, input)
+    var out bytes.Buffer
+    if err := writeTOCJSON(&out, pageRef{name: "tool", section: "1"}, input, body); err != nil {
+        t.Fatal(err)
+    }
+    // Lines are those of the file, front matter and all.
+    for _, want := range []string{`"line": 6`, `"line": 8`} {
+        if !strings.Contains(out.String(), want) {
+            t.Errorf("table of contents lacks %s:\n%s", want, out.String())
+        }
+    }
+}
+
+func TestFormat_HeadingAnchors(t *testing.T) {
+    input := "# tool(1)\n\n## Options\n\n#### -b, --browse\nBrowse.\n\n## Options\n"
+    pages := []outputPage{{pageRef{name: "tool", section: "1"}, mandown.Meta{}, []byte(input)}}
+    var out bytes.Buffer
+    if err := (&library{}).writeFormat(&out, "html", pages, 0); err != nil {
+        t.Fatal(err)
+    }
+    // Headings have the anchors --toc lists.
+    for _, want := range []string{
+        `<h1 id="tool1">`,
+        `<h2 id="options">`,
+        `<h4 id="-b---browse">`,
+        `<h2 id="options-1">`,
+    } {
+        if !strings.Contains(out.String(), want) {
+            t.Errorf("HTML lacks %s:\n%s", want, out.String())
+        }
+    }
+}
+
+// failingWriter is a writer whose writes all fail.
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestFormat_WriteErrors(t *testing.T) {
+    pages := []outputPage{{pageRef{name: "tool", section: "1"}, mandown.Meta{}, []byte("# tool(1)\n\nText.\n")}}
+    for _, format := range []string{"text", "html", "md", "json"} {
+        if err := (&library{}).writeFormat(failingWriter{}, format, pages, 0); err == nil {
+            t.Errorf("writeFormat(%s) to a failing writer succeeded, want its error", format)
+        }
+    }
+}
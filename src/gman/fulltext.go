@@ -0,0 +1,353 @@
+// Copyright 2014 The Gman Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in LICENSE file.
+
+package main
+
+import (
+    "errors"  // for reporting errors
+    "mandown" // for splitting pages into sections
+    "math"    // for term weights
+    "sort"    // for ranking hits
+    "strings" // for string manipulation
+    "unicode" // for splitting text into terms
+)
+
+// textSection is the text of a page between one heading and the next, as
+// stored in the index for full-text search.
+type textSection struct {
+    Path    []string `json:"path"`    // enclosing headings, outermost first
+    HeadLen int      `json:"headlen"` // number of terms in the heading
+    Text    string   `json:"text"`
+}
+
+// posting records where a term occurs: the entry, the section within it and
+// the term positions, counting the heading's terms first.
+type posting struct {
+    Entry   int   `json:"e"`
+    Section int   `json:"s"`
+    Pos     []int `json:"p"`
+}
+
+// searchHit is a section matching a full-text query.
+type searchHit struct {
+    entry   indexEntry
+    section textSection
+    score   float64
+}
+
+// query is a parsed full-text query. Every phrase must occur in a section
+// for it to match; a single word is a phrase of one term.
+type query struct {
+    phrases [][]string
+    scope   string // only search sections under a heading containing this
+}
+
+// textSections splits a page into the text under each heading. Text before
+// the first heading belongs to a section with an empty path.
+func textSections(input []byte) []textSection {
+    doc := mandown.Parse(input)
+    var sections []textSection
+    var parents []mandown.Block
+    start := 0
+    var path []string
+    flush := func(end int) {
+        text := cleanText(doc.Source(start, end))
+        if text == "" && len(path) == 0 {
+            return
+        }
+        headLen := 0
+        if len(path) > 0 {
+            headLen = len(terms(path[len(path)-1]))
+        }
+        sections = append(sections, textSection{Path: path, HeadLen: headLen, Text: text})
+    }
+    for _, h := range doc.Headings() {
+        flush(h.Start)
+        for len(parents) > 0 && parents[len(parents)-1].Level >= h.Level {
+            parents = parents[:len(parents)-1]
+        }
+        parents = append(parents, h)
+        path = nil
+        for _, p := range parents {
+            path = append(path, cleanText(p.Title))
+        }
+        start = h.End
+    }
+    flush(len(doc.Lines))
+    return sections
+}
+
+// cleanText drops Markdown emphasis and code markers and collapses white
+// space, leaving text fit for snippets.
+func cleanText(s string) string {
+    s = strings.NewReplacer("*", "", "`", "", "\\", "").Replace(s)
+    return strings.Join(strings.Fields(s), " ")
+}
+
+// terms splits text into lower case search terms. Dashes and underscores
+// inside words are kept, as are leading dashes, so "--section-regex" is a
+// single term.
+func terms(text string) []string {
+    var result []string
+    for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+        return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_'
+    }) {
+        if word = strings.TrimRight(word, "-_"); word != "" && strings.Trim(word, "-_") != "" {
+            result = append(result, word)
+        }
+    }
+    return result
+}
+
+// rebuildTerms recreates the inverted index from the entries' sections.
+func (idx *pageIndex) rebuildTerms() {
+    idx.Terms = make(map[string][]posting)
+    for ei, e := range idx.Entries {
+        for si, sec := range e.Sections {
+            heading := ""
+            if len(sec.Path) > 0 {
+                heading = sec.Path[len(sec.Path)-1]
+            }
+            positions := make(map[string][]int)
+            for pos, t := range append(terms(heading), terms(sec.Text)...) {
+                positions[t] = append(positions[t], pos)
+            }
+            for t, p := range positions {
+                idx.Terms[t] = append(idx.Terms[t], posting{ei, si, p})
+            }
+        }
+    }
+}
+
+// parseQuery parses full-text query arguments. An argument holding several
+// words, or words in double quotes, is a phrase. A "section:" argument, as
+// in "section:options", limits the search to sections under a matching
+// heading.
+func parseQuery(args []string) (query, error) {
+    var q query
+    var phrase []string
+    quoted := false
+    for _, arg := range args {
+        if !quoted && strings.HasPrefix(strings.ToLower(arg), "section:") {
+            q.scope = strings.ToLower(arg[len("section:"):])
+            continue
+        }
+        if !quoted && !strings.Contains(arg, `"`) && len(strings.Fields(arg)) > 1 {
+            q.phrases = append(q.phrases, terms(arg))
+            continue
+        }
+        for i, part := range strings.Split(arg, `"`) {
+            if i > 0 {
+                if quoted && len(phrase) > 0 {
+                    q.phrases = append(q.phrases, phrase)
+                }
+                phrase = nil
+                quoted = !quoted
+            }
+            for _, t := range terms(part) {
+                if quoted {
+                    phrase = append(phrase, t)
+                } else {
+                    q.phrases = append(q.phrases, []string{t})
+                }
+            }
+        }
+    }
+    if quoted && len(phrase) > 0 {
+        q.phrases = append(q.phrases, phrase)
+    }
+    if len(q.phrases) == 0 {
+        return q, errors.New("gman: nothing to search for")
+    }
+    return q, nil
+}
+
+// search returns the sections of the given entries that match q, best
+// first. A section's score adds up the weight of each phrase occurrence,
+// counting occurrences in the heading double.
+func (idx *pageIndex) search(q query, entries []int) []searchHit {
+    allowed := make(map[int]bool)
+    for _, ei := range entries {
+        allowed[ei] = true
+    }
+
+    type key struct{ e, s int }
+    scores := make(map[key]float64)
+    for pi, phrase := range q.phrases {
+        postings := idx.Terms[phrase[0]]
+        weight := math.Log(1 + float64(len(idx.Entries))/float64(1+len(postings)))
+        found := make(map[key]float64)
+        for _, p := range postings {
+            k := key{p.Entry, p.Section}
+            if !allowed[p.Entry] || (pi > 0 && scores[k] == 0) {
+                continue
+            }
+            sec := idx.Entries[p.Entry].Sections[p.Section]
+            for _, pos := range p.Pos {
+                if idx.phraseAt(phrase, p.Entry, p.Section, pos) {
+                    if pos < sec.HeadLen {
+                        found[k] += 2 * weight
+                    } else {
+                        found[k] += weight
+                    }
+                }
+            }
+        }
+        // Every phrase must match, so keep only the sections found again.
+        next := make(map[key]float64)
+        for k, s := range found {
+            if s > 0 && (pi == 0 || scores[k] > 0) {
+                next[k] = scores[k] + s
+            }
+        }
+        scores = next
+    }
+
+    var hits []searchHit
+    for k, score := range scores {
+        e := idx.Entries[k.e]
+        sec := e.Sections[k.s]
+        if q.scope != "" && !inScope(sec.Path, q.scope) {
+            continue
+        }
+        hits = append(hits, searchHit{e, sec, score})
+    }
+    sort.Slice(hits, func(i, j int) bool {
+        if hits[i].score != hits[j].score {
+            return hits[i].score > hits[j].score
+        }
+        if hits[i].entry.Name != hits[j].entry.Name {
+            return hits[i].entry.Name < hits[j].entry.Name
+        }
+        return strings.Join(hits[i].section.Path, "/") < strings.Join(hits[j].section.Path, "/")
+    })
+    return hits
+}
+
+// phraseAt reports whether the terms of phrase follow one another starting
+// at pos in the given section.
+func (idx *pageIndex) phraseAt(phrase []string, entry, section, pos int) bool {
+    for i, t := range phrase[1:] {
+        found := false
+        for _, p := range idx.Terms[t] {
+            if p.Entry != entry || p.Section != section {
+                continue
+            }
+            for _, q := range p.Pos {
+                if q == pos+i+1 {
+                    found = true
+                }
+            }
+            break
+        }
+        if !found {
+            return false
+        }
+    }
+    return true
+}
+
+// inScope reports whether a heading on path contains scope, ignoring case.
+func inScope(path []string, scope string) bool {
+    for _, h := range path {
+        if strings.Contains(strings.ToLower(h), scope) {
+            return true
+        }
+    }
+    return false
+}
+
+// selected returns the indexes of the entries that page lookup would pick
+// for v: of the variants of each page for an os in v, the one for the most
+// preferred os and then lang. Pages whose front matter names other oses
+// than that of their directory are left out.
+func (idx *pageIndex) selected(v variants) []int {
+    rank := func(list []string, s string) int {
+        for i, l := range list {
+            if l == s {
+                return i
+            }
+        }
+        return -1
+    }
+    best := make(map[string]int)
+    var order []string
+    for ei, e := range idx.Entries {
+        o, l := rank(v.oses, e.OS), rank(v.langs, e.Lang)
+        if o < 0 || l < 0 || !forOS(e.Meta.OS, v.pageOS(e.OS)) {
+            continue
+        }
+        key := e.Name + "(" + e.Section + ")"
+        prev, ok := best[key]
+        if !ok {
+            order = append(order, key)
+        }
+        pe := idx.Entries[prev]
+        if !ok || o < rank(v.oses, pe.OS) || o == rank(v.oses, pe.OS) && l < rank(v.langs, pe.Lang) {
+            best[key] = ei
+        }
+    }
+    var result []int
+    for _, key := range order {
+        result = append(result, best[key])
+    }
+    return result
+}
+
+// snippet returns about width characters of text around the first match of
+// q, with every query term passed through mark.
+func snippet(text string, q query, width int, mark func(string) string) string {
+    words := strings.Fields(text)
+    want := make(map[string]bool)
+    for _, phrase := range q.phrases {
+        for _, t := range phrase {
+            want[t] = true
+        }
+    }
+    matches := func(w string) bool {
+        for _, t := range terms(w) {
+            if want[t] {
+                return true
+            }
+        }
+        return false
+    }
+
+    first := 0
+    for i, w := range words {
+        if matches(w) {
+            first = i
+            break
+        }
+    }
+    // Back up a few words for context, then take words up to width.
+    start := first - 4
+    if start < 0 {
+        start = 0
+    }
+    var out []string
+    n := 0
+    end := start
+    for ; end < len(words) && n < width; end++ {
+        w := words[end]
+        n += len(w) + 1
+        if matches(w) {
+            // Mark the word itself, not the punctuation around it.
+            core := strings.TrimFunc(w, func(r rune) bool {
+                return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_'
+            })
+            i := strings.Index(w, core)
+            w = w[:i] + mark(core) + w[i+len(core):]
+        }
+        out = append(out, w)
+    }
+    s := strings.Join(out, " ")
+    if start > 0 {
+        s = "..." + s
+    }
+    if end < len(words) {
+        s += "..."
+    }
+    return s
+}
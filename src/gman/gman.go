@@ -18,18 +18,14 @@
 package main
 
 import (
-    "bufio"                            // for section extraction
-    "bytes"                            // for section extraction
-    "compress/gzip"                    // for gzip io
-    "errors"                           // for reporting errors
-    "fmt"                              // for printing runtime errors
-    "github.com/grymoire7/blackfriday" // markdown parser
-    "io"                               // for piping through pager
-    "io/ioutil"                        // for reading files and logging
-    "log"                              // for debug logging
-    "os"                               // for local file access
-    "os/exec"                          // for piping through pager
-    "strings"                          // for string manipulation
+    "bytes"     // for section extraction
+    "fmt"       // for printing runtime errors
+    "io"        // for piping through pager
+    "io/ioutil" // for reading files and logging
+    "log"       // for debug logging
+    "os"        // for local file access
+    "os/exec"   // for piping through pager
+    "strings"   // for string manipulation
 )
 
 func init() {
@@ -39,12 +35,9 @@ func main() {
     // Get configuration options from rc files and command line.
     opts := readConfig()
 
-    terminalFlags := 0
-
     // Discard logging messages if not in debug mode.
     if debug, ok := opts["--debug"]; ok && debug.(bool) {
         log.Println("Debug on")
-        terminalFlags |= blackfriday.TERM_DEBUG_LOGGING
     } else {
         log.SetOutput(ioutil.Discard)
     }
@@ -56,65 +49,364 @@ func main() {
         }
     }
 
-    // TODO: Should be more robust. Should search a path collection and allow
-    // missing os and lang dirs.
-    page := opts["<page>"].(string)
-    gmanpath := opts["gmanpath"].(string)
-    pagepath := gmanpath + "/linux/en/gman1/" + page + ".1.md"
-    gzpagepath := gmanpath + "/linux/en/gman1/" + page + ".1.gz"
+    // Print the effective search order if requested.
+    lib := newLibrary(opts)
+    if showPath, ok := opts["--path"].(bool); ok && showPath {
+        for _, root := range lib.roots {
+            fmt.Println(root)
+        }
+        os.Exit(0)
+    }
+
+    // Serve the library over HTTP for -b.
+    if browse, _ := opts["--browse"].(bool); browse {
+        port, _ := opts["--port"].(string)
+        if port == "" {
+            port = defaultPort
+        }
+        lib.index = loadIndex(indexFile(opts))
+        if err := lib.browse(port); err != nil {
+            fmt.Fprintln(os.Stderr, "gman:", err)
+            os.Exit(-1)
+        }
+        os.Exit(0)
+    }
 
-    var input []byte
-    var err error
+    // Write pages as man pages for build-man.
+    if build, _ := opts["build-man"].(bool); build {
+        dir, _ := opts["--output"].(string)
+        if dir == "" {
+            dir = defaultManDir
+        }
+        lib.index = loadIndex(indexFile(opts))
+        names, _ := opts["<page>"].([]string)
+        files, errs := lib.buildMan(dir, names)
+        for _, err := range errs {
+            fmt.Fprintln(os.Stderr, err)
+        }
+        fmt.Printf("gman: wrote %d man pages to %s\n", len(files), dir)
+        if len(errs) > 0 {
+            os.Exit(1)
+        }
+        os.Exit(0)
+    }
 
-    // try to open the compressed version first
-    f, err := os.Open(gzpagepath)
-    if err != nil {
-        // else try to open the non-compressed version
-        if input, err = ioutil.ReadFile(pagepath); err != nil {
-            fmt.Fprintln(os.Stderr, "gman: help page", page, "not found")
-            log.Println("Error reading from", pagepath, ":", err)
+    // Bring the page index up to date.
+    if update, _ := opts["--update-index"].(bool); update {
+        idx := loadIndex(indexFile(opts))
+        added, updated, removed := idx.update(lib)
+        if err := idx.save(); err != nil {
+            fmt.Fprintln(os.Stderr, "gman: cannot save page index:", err)
             os.Exit(-1)
         }
-    } else {
-        defer f.Close()
-        gz, err := gzip.NewReader(f)
+        fmt.Printf("gman: indexed %d pages (%d added, %d updated, %d removed) in %s\n",
+            len(idx.Entries), added, updated, removed, idx.file)
+        os.Exit(0)
+    }
+
+    // Search page names and descriptions for -k.
+    if expr, ok := opts["--apropos"].(string); ok {
+        idx := lib.openIndex(indexFile(opts))
+        matches, err := apropos(idx.summaries(lib.v.langs), expr)
         if err != nil {
-            fmt.Fprintln(os.Stderr, "gman: help page", page, "not found")
-            log.Println("Error reading from", gzpagepath, ":", err)
+            fmt.Fprintln(os.Stderr, err)
             os.Exit(-1)
-        } else {
-            // is there a better way to do this?
-            buf := bytes.NewBuffer(input)
-            _, err := io.Copy(buf, gz)
+        }
+        if len(matches) == 0 {
+            fmt.Fprintln(os.Stderr, expr+": nothing appropriate.")
+            os.Exit(1)
+        }
+        for _, m := range matches {
+            fmt.Println(m.line(lib.v.oses[0]))
+        }
+        os.Exit(0)
+    }
+
+    // Search the text of all pages for -K.
+    if search, _ := opts["--search"].(bool); search {
+        q, err := parseQuery(opts["<term>"].([]string))
+        if err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            os.Exit(-1)
+        }
+        idx := lib.openIndex(indexFile(opts))
+        hits := idx.search(q, idx.selected(lib.v))
+        if len(hits) == 0 {
+            fmt.Fprintln(os.Stderr, "gman: nothing found")
+            os.Exit(1)
+        }
+        color, err := useColor(opts)
+        if err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            os.Exit(-1)
+        }
+        mark := func(w string) string { return "*" + w + "*" }
+        if color {
+            mark = func(w string) string { return "\x1b[1m" + w + "\x1b[0m" }
+        }
+        for _, h := range hits {
+            // The title heading is already named by the page.
+            path := h.section.Path
+            if len(path) > 0 && path[0] == cleanText(h.entry.Title) {
+                path = path[1:]
+            }
+            fmt.Println(strings.Join(append([]string{h.entry.Name + "(" + h.entry.Section + ")"}, path...), " › "))
+            fmt.Println("    " + snippet(h.section.Text, q, 72, mark))
+        }
+        os.Exit(0)
+    }
+
+    // Print the one-line description of each page for -f.
+    if whatis, _ := opts["--whatis"].(bool); whatis {
+        lib.index = loadIndex(indexFile(opts))
+        status := 0
+        for _, name := range opts["<page>"].([]string) {
+            refs, err := lib.lookup(name, "", true)
             if err != nil {
-                fmt.Fprintln(os.Stderr, "gman: help page", page, "not found")
-                log.Println("Error reading from", gzpagepath, ":", err)
-                os.Exit(-1)
+                log.Println(err)
+                fmt.Fprintln(os.Stderr, name+": nothing appropriate.")
+                status = 1
+                continue
+            }
+            for _, ref := range refs {
+                input, err := lib.readPage(ref)
+                if err != nil {
+                    fmt.Fprintln(os.Stderr, readError(ref, err))
+                    status = 1
+                    continue
+                }
+                meta, body := splitPage(ref, input)
+                fmt.Println(pageSummary{ref, pageDescription(meta, body), nil, nil}.line(lib.v.oses[0]))
             }
-            input = buf.Bytes()
         }
+        os.Exit(status)
     }
 
-    // handle section extraction option
-    if opts["-s"] != nil {
-        log.Println("Exracting", opts["-s"], "...")
-        c, err := extractDocSection(input, opts["-s"].(string))
-        if err == nil {
-            input = c
+    // List page names for shell completion.
+    if prefix, ok := opts["--complete"].(string); ok {
+        idx := lib.openIndex(indexFile(opts))
+        for _, name := range idx.complete(prefix, lib.v.langs) {
+            fmt.Println(name)
+        }
+        os.Exit(0)
+    }
+
+    // As with man, a leading section name picks the section. A page
+    // argument such as "rsync -a -v" asks for particular options, and one
+    // such as "git commit" for a subcommand.
+    args, _ := opts["<page>"].([]string)
+    var section string
+    if len(args) > 1 && isSection(args[0]) {
+        section, args = args[0], args[1:]
+    }
+    words := strings.Fields(strings.Join(args, " "))
+    if len(words) == 0 {
+        fmt.Fprintln(os.Stderr, "gman: no help page given")
+        os.Exit(-1)
+    }
+    page := words[0]
+    all, _ := opts["--all"].(bool)
+    log.Println("Searching os", lib.v.oses, "and lang", lib.v.langs)
+    source, _ := opts["--query"].(string)
+    if source != "" && source != "gman" && source != "man" && source != "help" {
+        fmt.Fprintln(os.Stderr, "gman: unknown page source", source+"; use gman, man or help")
+        os.Exit(-1)
+    }
+    format, err := outputFormat(opts)
+    if err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(-1)
+    }
+    var refs []pageRef
+    var subs, optionArgs []string
+    err = os.ErrNotExist
+    if source == "" || source == "gman" {
+        lib.index = loadIndex(indexFile(opts))
+        refs, subs, optionArgs, err = lib.lookupCommand(words, section, all)
+        if err == os.ErrNotExist {
+            // The index may be too old to know the page by another name.
+            lib.openIndex(indexFile(opts))
+            refs, subs, optionArgs, err = lib.lookupCommand(words, section, all)
+        }
+    }
+    if err != nil && err != os.ErrNotExist {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(-1)
+    }
+    // Fall back to the system man page unless only gman pages are wanted.
+    if err != nil && triesMan(source) {
+        refs, subs, optionArgs, err = lib.lookupManCommand(words, section)
+    }
+    // As a last resort, and only if configured, make a page from the
+    // command's --help output.
+    if err != nil && (source == "help" || source == "" && helpFallback(opts)) {
+        if ref, ok := findHelpRef(page, section); ok {
+            log.Println("Using", ref.path, "--help")
+            refs, subs, optionArgs, err = []pageRef{ref}, nil, words[1:], nil
+        }
+    }
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "gman: help page", page, "not found")
+        if source == "" || source == "gman" {
+            lib.explainMissing(os.Stderr, lib.index, page, section)
+        }
+        os.Exit(-1)
+    }
+
+    // Print the heading outline instead of the page if asked.
+    if toc, _ := opts["--toc"].(bool); toc {
+        input, err := lib.readPage(refs[0])
+        if err != nil {
+            fmt.Fprintln(os.Stderr, readError(refs[0], err))
+            log.Println("Error reading from", refs[0].path, ":", err)
+            os.Exit(-1)
+        }
+        _, body := splitPage(refs[0], input)
+        if asJSON, _ := opts["--json"].(bool); asJSON {
+            err = writeTOCJSON(os.Stdout, refs[0], input, body)
         } else {
-            fmt.Fprintln(os.Stderr, err)
+            writeTOC(os.Stdout, body)
+        }
+        if err != nil {
+            fmt.Fprintln(os.Stderr, "gman:", err)
             os.Exit(-1)
         }
+        os.Exit(0)
+    }
+
+    save, _ := opts["--save"].(bool)
+    if save && refs[0].source != "help" {
+        fmt.Fprintln(os.Stderr, "gman: only pages made from --help output can be saved")
+        os.Exit(-1)
+    }
+
+    selectors, err := sectionSelectors(opts)
+    if err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(-1)
     }
 
-    extensions := 0
-    extensions |= blackfriday.EXTENSION_NO_INTRA_EMPHASIS
-    extensions |= blackfriday.EXTENSION_TABLES
-    extensions |= blackfriday.EXTENSION_FENCED_CODE
-    extensions |= blackfriday.EXTENSION_AUTOLINK
+    // With -a every matching page is shown in turn, separated by a rule.
+    var pages []outputPage
+    for _, ref := range refs {
+        log.Println("Reading page from", ref.path)
+        input, err := lib.readPage(ref)
+        if err != nil {
+            fmt.Fprintln(os.Stderr, readError(ref, err))
+            log.Println("Error reading from", ref.path, ":", err)
+            os.Exit(-1)
+        }
 
-    renderer := blackfriday.TerminalRenderer(terminalFlags)
-    output := blackfriday.Markdown(input, renderer, extensions)
+        // Keep a page made from --help output for later editing.
+        if save {
+            file, err := lib.saveHelpPage(ref, input)
+            if err != nil {
+                fmt.Fprintln(os.Stderr, "gman: cannot save page:", err)
+                os.Exit(-1)
+            }
+            fmt.Fprintln(os.Stderr, "gman: saved", ref.name, "to", file)
+        }
+        meta, input := splitPage(ref, input)
+        if ref.redirectedFrom != "" {
+            input = markRedirect(input, ref.redirectedFrom)
+        }
+
+        // Show only a subcommand's section if the page has one, as for
+        // "gman git commit", or else say so and show the whole page.
+        if len(subs) > 0 {
+            if c, ok := subcommandSection(input, ref.name, subs); ok {
+                log.Println("Showing section", subs, "of", ref.path)
+                input = c
+            } else {
+                log.Println("No section", subs, "in", ref.path+"; showing the whole page")
+                fmt.Fprintln(os.Stderr, "gman: no section for subcommand", strings.Join(subs, " "), "in", ref.name)
+            }
+        }
+
+        // handle section extraction option
+        if len(selectors) > 0 {
+            log.Println("Exracting", opts["--section"], opts["--section-regex"], "...")
+            c, missing, err := extractDocSections(input, selectors)
+            for _, m := range missing {
+                log.Println("No section", m, "in", ref.path)
+                if len(refs) == 1 && err == nil {
+                    fmt.Fprintln(os.Stderr, "gman: document section", m, "not found")
+                }
+            }
+            if err != nil {
+                if len(refs) > 1 {
+                    continue
+                }
+                fmt.Fprintln(os.Stderr, err)
+                os.Exit(-1)
+            }
+            input = c
+        }
+
+        // handle option extraction
+        if len(optionArgs) > 0 {
+            log.Println("Extracting options", optionArgs, "...")
+            c, missing, err := extractOptions(input, optionArgs)
+            for _, m := range missing {
+                fmt.Fprintln(os.Stderr, "gman: no documentation for option", m, "in", ref.name)
+            }
+            if err != nil {
+                if len(refs) > 1 {
+                    continue
+                }
+                fmt.Fprintln(os.Stderr, err)
+                os.Exit(-1)
+            }
+            input = c
+        }
+
+        // Say so when the page is for another os or language.
+        if notice := variantNotice(ref, lib.v); notice != "" {
+            input = append([]byte(notice), input...)
+        }
+        pages = append(pages, outputPage{ref, meta, input})
+    }
+    if len(pages) == 0 {
+        fmt.Fprintln(os.Stderr, "gman: document section not found")
+        os.Exit(-1)
+    }
+
+    // Write other formats as they are, for scripts and other tools.
+    width, err := outputWidth(opts)
+    if err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(-1)
+    }
+    if format != "term" {
+        if err := lib.writeFormat(os.Stdout, format, pages, width); err != nil {
+            fmt.Fprintln(os.Stderr, "gman:", err)
+            os.Exit(-1)
+        }
+        os.Exit(0)
+    }
+
+    // Lay the pages out for the terminal, filled to its width and styled
+    // by the theme if color is wanted.
+    layout := &textLayout{width: width}
+    color, err := useColor(opts)
+    if err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(-1)
+    }
+    if color {
+        t, err := loadTheme(opts)
+        if err != nil {
+            fmt.Fprintln(os.Stderr, err)
+            os.Exit(-1)
+        }
+        layout.style = t.style
+    }
+    var buf bytes.Buffer
+    if err := layout.write(&buf, pages); err != nil {
+        fmt.Fprintln(os.Stderr, "gman:", err)
+        os.Exit(-1)
+    }
+    output := buf.Bytes()
 
     pager := opts["--pager"].(string)
     if pager == "nil" || pager == "null" {
@@ -143,7 +435,7 @@ func main() {
     }()
 
     // Pass output to the pipe
-    fmt.Fprintf(stdin, string(output))
+    stdin.Write(output)
 
     // Close stdin (allows pager to exit)
     stdin.Close()
@@ -152,41 +444,8 @@ func main() {
     <-c
 }
 
-func extractDocSection(input []byte, sectionPattern string) ([]byte, error) {
-    var lines []string
-    var inSection = false
-    var foundSection = false
-    var sectionLevel = 0
-    scanner := bufio.NewScanner(bytes.NewReader(input))
-    for scanner.Scan() {
-        line := scanner.Text()
-        if strings.HasPrefix(line, "#") {
-            var level = 0
-            for _, c := range line {
-                if c != '#' {
-                    break
-                }
-                level++
-            }
-            if inSection {
-                if level <= sectionLevel {
-                    inSection = false
-                }
-            } else {
-                if strings.Contains(line, sectionPattern) {
-                    inSection = true
-                    foundSection = true
-                    sectionLevel = level
-                }
-            }
-        }
-        if inSection {
-            lines = append(lines, scanner.Text())
-        }
-    }
-    s := strings.Join(lines, "\n")
-    if !foundSection {
-        return nil, errors.New("gman: document section not found")
-    }
-    return []byte(s), scanner.Err()
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+    fi, err := f.Stat()
+    return err == nil && fi.Mode()&os.ModeCharDevice != 0
 }
@@ -0,0 +1,189 @@
+// Copyright 2014 The Gman Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in LICENSE file.
+
+package main
+
+import (
+    "bytes"         // for collecting command output
+    "context"       // for timing out commands
+    "errors"        // for reporting errors
+    "fmt"           // for formatting pages
+    "os"            // for saving pages
+    "os/exec"       // for running commands
+    "path/filepath" // for building page paths
+    "regexp"        // for parsing help output
+    "strings"       // for string manipulation
+    "time"          // for timing out commands
+)
+
+// helpTimeout bounds how long a command may take to print its help.
+const helpTimeout = 3 * time.Second
+
+var (
+    // usageRe matches the line starting a usage block, such as
+    // "Usage: tool [options] file".
+    usageRe = regexp.MustCompile(`(?i)^\s*usage:\s*(.*)$`)
+
+    // helpArgRe matches an option argument such as "<file>".
+    helpArgRe = regexp.MustCompile(`<([^<>]+)>`)
+
+    // helpGapRe matches the gap between an option and its description.
+    helpGapRe = regexp.MustCompile(`\s{2,}|\t`)
+)
+
+// helpFallback reports whether the help-fallback config key asks for pages
+// to be made from --help output when there is no other page.
+func helpFallback(opts map[string]interface{}) bool {
+    fallback, _ := opts["help-fallback"].(bool)
+    return fallback
+}
+
+// findHelpRef returns a page for the command name on the PATH, to be made
+// from its --help output, or false if there is no such command. Such pages
+// are in section 1.
+func findHelpRef(name, section string) (pageRef, bool) {
+    if strings.ContainsRune(name, filepath.Separator) || section != "" && section != "1" {
+        return pageRef{}, false
+    }
+    path, err := exec.LookPath(name)
+    if err != nil {
+        return pageRef{}, false
+    }
+    return pageRef{name: name, section: "1", path: path, source: "help"}, true
+}
+
+// readHelpPage runs the command with --help, with no input and a time
+// limit, and returns a page made from what it prints. Commands often print
+// their help on stderr or exit with an error status, so both outputs are
+// used and the status is ignored when there is output.
+func readHelpPage(ref pageRef) ([]byte, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), helpTimeout)
+    defer cancel()
+    cmd := exec.CommandContext(ctx, ref.path, "--help")
+    cmd.WaitDelay = time.Second
+    var out bytes.Buffer
+    cmd.Stdout, cmd.Stderr = &out, &out
+    err := cmd.Run()
+    if ctx.Err() != nil {
+        return nil, fmt.Errorf("%s --help took longer than %v", ref.name, helpTimeout)
+    }
+    if len(bytes.TrimSpace(out.Bytes())) == 0 {
+        if err == nil {
+            err = errors.New("no output")
+        }
+        return nil, fmt.Errorf("%s --help: %v", ref.name, err)
+    }
+    return helpPage(ref.name, out.Bytes()), nil
+}
+
+// helpOption is an option line from --help output and its description.
+type helpOption struct {
+    names  string
+    indent int
+    text   []string
+}
+
+// helpPage turns the --help output of the command name into a page with
+// Synopsis, Description and Options sections. The usage block, up to the
+// next blank line, becomes the synopsis; indented lines starting with a dash
+// are options, described by the text after them and by the more indented
+// lines that follow; other text is the description. Lines such as
+// "Options:" only introduce a group and are dropped.
+func helpPage(name string, output []byte) []byte {
+    var synopsis, description []string
+    var options []helpOption
+    inUsage := false
+    var opt *helpOption
+    for _, line := range strings.Split(string(output), "\n") {
+        line = strings.TrimRight(line, " \t\r")
+        trimmed := strings.TrimSpace(line)
+        indent := len(line) - len(strings.TrimLeft(line, " \t"))
+        switch {
+        case trimmed == "":
+            inUsage, opt = false, nil
+            if len(description) > 0 && description[len(description)-1] != "" {
+                description = append(description, "")
+            }
+        case usageRe.MatchString(line):
+            inUsage, opt = true, nil
+            if rest := usageRe.FindStringSubmatch(line)[1]; rest != "" {
+                synopsis = append(synopsis, rest)
+            }
+        case strings.HasPrefix(trimmed, "-"):
+            inUsage = false
+            parts := helpGapRe.Split(trimmed, 2)
+            options = append(options, helpOption{names: parts[0], indent: indent})
+            opt = &options[len(options)-1]
+            if len(parts) > 1 {
+                opt.text = append(opt.text, parts[1])
+            }
+        case inUsage:
+            synopsis = append(synopsis, trimmed)
+        case opt != nil && indent > opt.indent:
+            opt.text = append(opt.text, trimmed)
+        case strings.HasSuffix(trimmed, ":") && !strings.Contains(trimmed, ". "):
+            opt = nil
+        default:
+            opt = nil
+            description = append(description, trimmed)
+        }
+    }
+    for len(description) > 0 && description[len(description)-1] == "" {
+        description = description[:len(description)-1]
+    }
+
+    title := "generated from " + name + " --help"
+    if len(description) > 0 {
+        title = strings.TrimSuffix(description[0], ".")
+    }
+    var b bytes.Buffer
+    fmt.Fprintf(&b, "# %s(1) -- %s\n\n", name, title)
+    fmt.Fprintf(&b, "> **Note:** this page was generated from the output of `%s --help`.\n", name)
+    if len(synopsis) > 0 {
+        b.WriteString("\n## Synopsis\n")
+        for _, line := range synopsis {
+            b.WriteString("    " + line + "\n")
+        }
+    }
+    if len(description) > 0 {
+        b.WriteString("\n## Description\n" + strings.Join(description, "\n") + "\n")
+    }
+    if len(options) > 0 {
+        b.WriteString("\n## Options\n")
+        for _, o := range options {
+            b.WriteString("#### " + helpArgRe.ReplaceAllString(o.names, "*$1*") + "\n")
+            if len(o.text) > 0 {
+                b.WriteString(strings.Join(o.text, "\n") + "\n")
+            }
+            b.WriteString("\n")
+        }
+    }
+    return bytes.TrimRight(b.Bytes(), "\n")
+}
+
+// saveHelpPage writes a page made from --help output into the first page
+// root that is a directory, for the preferred os and lang, and returns the
+// file written. An existing page is not overwritten.
+func (lib *library) saveHelpPage(ref pageRef, input []byte) (string, error) {
+    for _, root := range lib.roots {
+        if root == builtinRoot || isPack(root) {
+            continue
+        }
+        dir := filepath.Join(root, lib.v.oses[0], lib.v.langs[0], "gman"+ref.section)
+        if err := os.MkdirAll(dir, 0755); err != nil {
+            return "", err
+        }
+        file := filepath.Join(dir, ref.name+"."+ref.section+".md")
+        f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+        if err != nil {
+            return "", err
+        }
+        if _, err := f.Write(append(input, '\n')); err != nil {
+            f.Close()
+            return "", err
+        }
+        return file, f.Close()
+    }
+    return "", errors.New("no page root directory to save to")
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestHelpPage_Sections(t *testing.T) {
+    output := `tool does things.
+
+Usage: tool [options] <file>
+       tool --list
+
+Options:
+  -a, --all         Do all things,
+                    even hidden ones.
+  -o <file>, --output=<file>
+                    Write to file.
+  -v                Be verbose.
+`
+    page := helpPage("tool", []byte(output))
+    for _, want := range []string{
+        "# tool(1) -- tool does things\n",
+        "## Synopsis\n    tool [options] <file>\n    tool --list\n",
+        "## Description\ntool does things.\n",
+        "#### -a, --all\nDo all things,\neven hidden ones.\n",
+        "#### -o *file*, --output=*file*\nWrite to file.\n",
+    } {
+        if !strings.Contains(string(page), want) {
+            t.Errorf("page lacks %q:\n%s", want, page)
+        }
+    }
+
+    entries := optionEntries(page)
+    if len(entries) != 3 || !entries[1].takesArg["--output"] {
+        t.Errorf("option entries = %v, want 3 with --output taking an argument", entries)
+    }
+}
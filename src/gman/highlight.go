@@ -0,0 +1,138 @@
+// Copyright 2014 The Gman Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in LICENSE file.
+
+package main
+
+import (
+    "bytes"                            // for rendering code blocks
+    "fmt"                              // for writing code blocks
+    "github.com/grymoire7/blackfriday" // markdown parser
+    "highlight"                        // for highlighting code
+    "html"                             // for escaping code
+    "mandown"                          // for heading anchors
+    "regexp"                           // for finding heading text
+    "strings"                          // for string manipulation
+)
+
+// shellSections are the sections, by lowercase title, whose code blocks are
+// shell commands unless they name another language.
+var shellSections = map[string]bool{
+    "synopsis": true,
+    "example":  true,
+    "examples": true,
+}
+
+// htmlTagRe matches the tags in a rendered heading.
+var htmlTagRe = regexp.MustCompile(`<[^>]*>`)
+
+// highlightStyle styles highlighted code in HTML output.
+const highlightStyle = `<style>
+.gman-comment { color: #6a737d; font-style: italic; }
+.gman-keyword, .gman-operator { color: #a626a4; }
+.gman-string { color: #986801; }
+.gman-number { color: #5f00af; }
+.gman-variable, .gman-key { color: #005faf; }
+.gman-command { font-weight: bold; }
+.gman-option { color: #008787; font-weight: bold; }
+.gman-builtin { color: #008787; }
+.gman-inserted { color: #22863a; }
+.gman-deleted { color: #b31d28; }
+.gman-meta { color: #005faf; font-weight: bold; }
+</style>`
+
+// sectionLanguage returns the language of the code blocks that name none in
+// a section titled title, given that of the section holding it.
+func sectionLanguage(title, outer string) string {
+    if shellSections[strings.ToLower(strings.TrimSpace(title))] {
+        return "sh"
+    }
+    return outer
+}
+
+// codeLanguage returns the language a code block is highlighted in: the one
+// its fence info names, or lang if it names none. It returns "" if there is
+// no lexer for the language.
+func codeLanguage(info, lang string) string {
+    if strings.TrimSpace(info) != "" {
+        return highlight.Language(info)
+    }
+    return lang
+}
+
+// htmlRenderer renders pages as HTML, highlighting code blocks in the
+// languages there are lexers for and giving headings the anchors of the
+// table of contents.
+type htmlRenderer struct {
+    blackfriday.Renderer
+    langs []headingLang // the headings the text is under, outermost first
+    slugs []string      // anchors of the headings yet to be rendered
+}
+
+// headingLang is the language of the code blocks that name none below a
+// heading of the given level.
+type headingLang struct {
+    level int
+    lang  string
+}
+
+// newHTMLRenderer returns a renderer for the page body.
+func newHTMLRenderer(body []byte) *htmlRenderer {
+    r := &htmlRenderer{Renderer: blackfriday.HtmlRenderer(0, "", "")}
+    var walk func([]*mandown.Section)
+    walk = func(outline []*mandown.Section) {
+        for _, sec := range outline {
+            r.slugs = append(r.slugs, sec.Slug)
+            walk(sec.Children)
+        }
+    }
+    walk(mandown.Parse(body).Outline())
+    return r
+}
+
+// Header renders a heading with its anchor and notes the language of the
+// code below it.
+func (r *htmlRenderer) Header(out *bytes.Buffer, text func() bool, level int, id string) {
+    if id == "" && len(r.slugs) > 0 {
+        id, r.slugs = r.slugs[0], r.slugs[1:]
+    }
+    start := out.Len()
+    r.Renderer.Header(out, text, level, id)
+    title := html.UnescapeString(htmlTagRe.ReplaceAllString(out.String()[start:], ""))
+    for len(r.langs) > 0 && r.langs[len(r.langs)-1].level >= level {
+        r.langs = r.langs[:len(r.langs)-1]
+    }
+    r.langs = append(r.langs, headingLang{level, sectionLanguage(title, r.lang())})
+}
+
+// lang returns the language of code blocks that name none under the
+// current heading.
+func (r *htmlRenderer) lang() string {
+    if len(r.langs) == 0 {
+        return ""
+    }
+    return r.langs[len(r.langs)-1].lang
+}
+
+// BlockCode renders a code block, its tokens in spans of classes such as
+// "gman-comment".
+func (r *htmlRenderer) BlockCode(out *bytes.Buffer, text []byte, info string) {
+    lang := codeLanguage(info, r.lang())
+    tokens := highlight.Tokens(lang, string(text))
+    if tokens == nil {
+        r.Renderer.BlockCode(out, text, info)
+        return
+    }
+    if out.Len() > 0 {
+        out.WriteByte('\n')
+    }
+    fmt.Fprintf(out, "<pre><code class=\"language-%s\">", lang)
+    for _, t := range tokens {
+        if t.Kind == highlight.Text {
+            out.WriteString(html.EscapeString(t.Text))
+            continue
+        }
+        fmt.Fprintf(out, "<span class=\"gman-%s\">%s</span>", t.Kind, html.EscapeString(t.Text))
+    }
+    out.WriteString("</code></pre>\n")
+}
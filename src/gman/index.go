@@ -0,0 +1,252 @@
+// Copyright 2014 The Gman Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in LICENSE file.
+
+package main
+
+import (
+    "encoding/json" // for reading and writing the index
+    "io/ioutil"     // for reading and writing the index
+    "log"           // for debug logging
+    "mandown"       // for finding headings
+    "os"            // for local file access
+    "path/filepath" // for building the index path
+    "sort"          // for ordering completions
+    "strings"       // for string manipulation
+)
+
+// indexVersion changes whenever the index format does, so that an index
+// written by another version of gman is rebuilt rather than misread.
+const indexVersion = 5
+
+// indexEntry is what the index records about one page file.
+type indexEntry struct {
+    Name        string        `json:"name"`
+    Section     string        `json:"section"`
+    OS          string        `json:"os"`
+    Lang        string        `json:"lang"`
+    Path        string        `json:"path"`
+    Title       string        `json:"title"`
+    Description string        `json:"description"`
+    Headings    []string      `json:"headings"`
+    Options     []string      `json:"options"`
+    Sections    []textSection `json:"sections"`
+    Meta        mandown.Meta  `json:"meta"`
+    Redirect    string        `json:"redirect,omitempty"` // target of a redirect stub
+    ModTime     int64         `json:"mtime"`
+    Size        int64         `json:"size"`
+}
+
+// ref returns the page the entry describes.
+func (e indexEntry) ref() pageRef {
+    return pageRef{name: e.Name, section: e.Section, os: e.OS, lang: e.Lang, path: e.Path}
+}
+
+// pageIndex is the page index database. It lists every page under the
+// roots, in roots order, with what apropos, lookup, completion and full-text
+// search need to know about it without reading the page.
+type pageIndex struct {
+    Version int                  `json:"version"`
+    Entries []indexEntry         `json:"entries"`
+    Terms   map[string][]posting `json:"terms"` // inverted index of Sections
+
+    file string // where the index is stored
+}
+
+// indexFile returns where the index is stored: the index config key, or
+// gman/index.json in the user's cache directory.
+func indexFile(opts map[string]interface{}) string {
+    if file, ok := opts["index"].(string); ok && file != "" {
+        return expandHome(file)
+    }
+    dir, err := os.UserCacheDir()
+    if err != nil {
+        dir = expandHome("~/.cache")
+    }
+    return filepath.Join(dir, "gman", "index.json")
+}
+
+// loadIndex reads the index stored in file. A missing, unreadable or
+// outdated index gives an empty one.
+func loadIndex(file string) *pageIndex {
+    idx := &pageIndex{Version: indexVersion}
+    if data, err := ioutil.ReadFile(file); err != nil {
+        log.Println("No page index:", err)
+    } else if err := json.Unmarshal(data, idx); err != nil || idx.Version != indexVersion {
+        log.Println("Ignoring page index", file, err)
+        idx = &pageIndex{Version: indexVersion}
+    }
+    idx.file = file
+    return idx
+}
+
+// openIndex loads the library's index and brings it up to date, saving it
+// if anything changed.
+func (lib *library) openIndex(file string) *pageIndex {
+    idx := loadIndex(file)
+    if added, updated, removed := idx.update(lib); added+updated+removed > 0 {
+        log.Println("Page index was stale:", added, "added,", updated, "updated,", removed, "removed")
+        if err := idx.save(); err != nil {
+            log.Println("Error saving page index:", err)
+        }
+    }
+    lib.index = idx
+    return idx
+}
+
+// update brings the index up to date with the pages under the library's
+// roots. Only pages that are new, or whose size or modification time have
+// changed, are read. It returns how many entries were added, updated and
+// removed.
+func (idx *pageIndex) update(lib *library) (added, updated, removed int) {
+    old := make(map[string]indexEntry)
+    for _, e := range idx.Entries {
+        old[e.Path] = e
+    }
+
+    var entries []indexEntry
+    for _, ref := range lib.allPages() {
+        fi, err := lib.stat(ref.path)
+        if err != nil {
+            continue
+        }
+        e, ok := old[ref.path]
+        delete(old, ref.path)
+        if ok && e.ModTime == fi.ModTime().UnixNano() && e.Size == fi.Size() {
+            entries = append(entries, e)
+            continue
+        }
+        if ok {
+            updated++
+        } else {
+            added++
+        }
+        input, err := lib.readPage(ref)
+        if err != nil {
+            log.Println("Error reading from", ref.path, ":", err)
+        }
+        meta, body := splitPage(ref, input)
+        e = newIndexEntry(ref, meta, body)
+        e.ModTime, e.Size = fi.ModTime().UnixNano(), fi.Size()
+        entries = append(entries, e)
+    }
+    removed = len(old)
+
+    idx.Entries = entries
+    if added+updated+removed > 0 || idx.Terms == nil {
+        idx.rebuildTerms()
+    }
+    return added, updated, removed
+}
+
+// newIndexEntry returns the index entry for a page with the given front
+// matter and body. The page is in the section its front matter gives, if
+// any, rather than its directory's.
+func newIndexEntry(ref pageRef, meta mandown.Meta, input []byte) indexEntry {
+    e := indexEntry{Name: ref.name, Section: ref.section, OS: ref.os, Lang: ref.lang, Path: ref.path, Meta: meta}
+    if meta.Section != "" {
+        e.Section = meta.Section
+    }
+    if target, ok := redirectTarget(input); ok {
+        e.Redirect = target
+        return e
+    }
+    headings := mandown.Parse(input).Headings()
+    for _, h := range headings {
+        e.Headings = append(e.Headings, h.Title)
+    }
+    if len(headings) > 0 {
+        e.Title = headings[0].Title
+    }
+    e.Description = pageDescription(meta, input)
+    for _, entry := range optionEntries(input) {
+        e.Options = append(e.Options, entry.names...)
+    }
+    e.Sections = textSections(input)
+    return e
+}
+
+// save writes the index to its file, creating the directory if needed.
+func (idx *pageIndex) save() error {
+    data, err := json.Marshal(idx)
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(filepath.Dir(idx.file), 0755); err != nil {
+        return err
+    }
+    tmp := idx.file + ".tmp"
+    if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+        return err
+    }
+    return os.Rename(tmp, idx.file)
+}
+
+// pages returns the entries in the given languages. Where a page exists in
+// several languages or roots only the first one, in langs and then roots
+// order, is returned.
+func (idx *pageIndex) pages(langs []string) []indexEntry {
+    var result []indexEntry
+    seen := make(map[string]bool)
+    for _, lang := range langs {
+        for _, e := range idx.Entries {
+            key := e.Name + "(" + e.Section + ")" + e.OS
+            if e.Lang != lang || seen[key] {
+                continue
+            }
+            seen[key] = true
+            result = append(result, e)
+        }
+    }
+    return result
+}
+
+// summaries returns the summaries of the pages in the given languages.
+// Redirect stubs are left out, since the pages they lead to are listed.
+func (idx *pageIndex) summaries(langs []string) []pageSummary {
+    var result []pageSummary
+    for _, e := range idx.pages(langs) {
+        if e.Redirect != "" {
+            continue
+        }
+        result = append(result, pageSummary{e.ref(), e.Description, e.Meta.Tags, e.Meta.Aliases})
+    }
+    return result
+}
+
+// complete returns the sorted names and aliases of the pages in the given
+// languages that start with prefix.
+func (idx *pageIndex) complete(prefix string, langs []string) []string {
+    var names []string
+    seen := make(map[string]bool)
+    for _, e := range idx.pages(langs) {
+        for _, name := range append([]string{e.Name}, e.Meta.Aliases...) {
+            if strings.HasPrefix(name, prefix) && !seen[name] {
+                seen[name] = true
+                names = append(names, name)
+            }
+        }
+    }
+    sort.Strings(names)
+    return names
+}
+
+// metaNamed returns the pages of the entries in sel whose front matter gives
+// them name, as their name or an alias, in section if one is given. The
+// pages record name as the one asked for. A nil index has no pages.
+func (idx *pageIndex) metaNamed(name, section string, sel []int) []pageRef {
+    if idx == nil {
+        return nil
+    }
+    var refs []pageRef
+    for _, ei := range sel {
+        e := idx.Entries[ei]
+        named := e.Meta.Name == name || contains(e.Meta.Aliases, name)
+        if named && e.Name != name && (section == "" || section == e.Section) {
+            ref := e.ref()
+            ref.redirectedFrom = name
+            refs = append(refs, ref)
+        }
+    }
+    return refs
+}
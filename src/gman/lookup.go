@@ -0,0 +1,389 @@
+// Copyright 2014 The Gman Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in LICENSE file.
+
+package main
+
+import (
+    "bufio"         // for reading front matter
+    "io"            // for reading pages
+    "io/fs"         // for reading page roots
+    "log"           // for debug logging
+    "mandown"       // for reading front matter
+    "os"            // for local file access
+    "os/user"       // for finding user home directory
+    "path/filepath" // for building page paths
+    "regexp"        // for matching section names
+    "sort"          // for ordering sections
+    "strings"       // for string manipulation
+)
+
+// gmanPath returns the ordered list of page roots to search. A colon
+// separated GMANPATH environment variable takes priority over the gmanpath
+// config key, which may be either a string or an array of strings. As with
+// MANPATH, an empty GMANPATH component is replaced by the configured path.
+func gmanPath(opts map[string]interface{}) []string {
+    var configured []string
+    switch v := opts["gmanpath"].(type) {
+    case string:
+        configured = filepath.SplitList(v)
+    case []interface{}:
+        for _, p := range v {
+            if s, ok := p.(string); ok {
+                configured = append(configured, s)
+            }
+        }
+    }
+
+    roots := configured
+    if env := os.Getenv("GMANPATH"); env != "" {
+        roots = nil
+        for _, p := range filepath.SplitList(env) {
+            if p == "" {
+                roots = append(roots, configured...)
+            } else {
+                roots = append(roots, p)
+            }
+        }
+    }
+
+    // Expand home directories and drop duplicates, keeping the first.
+    var result []string
+    seen := make(map[string]bool)
+    for _, root := range roots {
+        root = expandHome(root)
+        if abs, err := filepath.Abs(root); err == nil && root != "" {
+            root = abs
+        }
+        if root == "" || seen[root] {
+            continue
+        }
+        seen[root] = true
+        result = append(result, root)
+    }
+    return result
+}
+
+// expandHome replaces a leading "~" in path with the user's home directory.
+func expandHome(path string) string {
+    if path != "~" && !strings.HasPrefix(path, "~/") {
+        return path
+    }
+    usr, err := user.Current()
+    if err != nil {
+        log.Println("Error finding user home directory:", err)
+        return path
+    }
+    return filepath.Join(usr.HomeDir, path[1:])
+}
+
+// defaultSections is the section search order used when the sections config
+// key is not set. It mirrors the SECTION list in man-db's man_db.conf.
+var defaultSections = []string{"1", "8", "3", "2", "5", "4", "9", "6", "7"}
+
+// sectionRe matches section names such as "1", "3p" or "8ssl".
+var sectionRe = regexp.MustCompile(`^[0-9][a-z0-9]*$`)
+
+// isSection reports whether s looks like a section name.
+func isSection(s string) bool {
+    return sectionRe.MatchString(s)
+}
+
+// pageRef identifies a page found under one of the roots, a system man
+// page or a command whose --help output is made into a page. The last two
+// are converted to Markdown when they are read.
+type pageRef struct {
+    name    string
+    section string
+    os      string
+    lang    string
+    path    string
+    source  string // "man" or "help" for pages not from a root
+    input   []byte // the contents of the page, if lookup has read them
+
+    redirectedFrom string // the name asked for, if lookup led elsewhere
+}
+
+// sectionOrder returns the section search order from the sections config
+// key, given either as an array or a space or colon separated string.
+func sectionOrder(opts map[string]interface{}) []string {
+    var sections []string
+    switch v := opts["sections"].(type) {
+    case string:
+        sections = strings.FieldsFunc(v, func(r rune) bool {
+            return r == ' ' || r == ':' || r == ','
+        })
+    case []interface{}:
+        for _, s := range v {
+            if str, ok := s.(string); ok {
+                sections = append(sections, str)
+            }
+        }
+    }
+    if len(sections) == 0 {
+        sections = defaultSections
+    }
+    return sections
+}
+
+// library is the collection of pages gman searches: the page roots and the
+// store holding each one's pages, the order sections are searched in, the
+// os and lang variants to prefer and, when one is available, the page index.
+// Page paths are the root joined with the page's name in its store.
+type library struct {
+    roots  []string
+    stores map[string]fs.FS
+    order  []string
+    v      variants
+    index  *pageIndex
+}
+
+// newLibrary returns the library described by the configuration, with the
+// built-in pages searched after the configured roots. Help packs are opened
+// when first searched, and one that cannot be, such as a corrupt pack, has
+// no pages.
+func newLibrary(opts map[string]interface{}) *library {
+    lib := &library{order: sectionOrder(opts), v: pageVariants(opts), stores: make(map[string]fs.FS)}
+    for _, root := range append(gmanPath(opts), builtinRoot) {
+        store, err := openStore(root)
+        if err != nil {
+            log.Println("Error opening page root:", err)
+            continue
+        }
+        lib.roots = append(lib.roots, root)
+        lib.stores[root] = store
+    }
+    return lib
+}
+
+// searchSections appends any gmanN section directories found under the
+// roots that are missing from the section order, so that every installed
+// section is searched.
+func (lib *library) searchSections() []string {
+    result := append([]string(nil), lib.order...)
+    seen := make(map[string]bool)
+    for _, s := range lib.order {
+        seen[s] = true
+    }
+    var extra []string
+    for _, root := range lib.roots {
+        for _, dir := range lib.glob(root, "*/*/gman*") {
+            s := strings.TrimPrefix(filepath.Base(dir), "gman")
+            if isSection(s) && !seen[s] {
+                seen[s] = true
+                extra = append(extra, s)
+            }
+        }
+    }
+    sort.Strings(extra)
+    return append(result, extra...)
+}
+
+// findPages searches the library for the named page. An empty section walks
+// the sections in priority order; a name such as "gman-mandown.7" selects
+// section 7. Unless all is set only the first match is returned, otherwise
+// the first match in each section is. Since front matter may put a page in
+// a section other than its directory's, a section asked for is searched
+// first and then the others, for pages that say they are in it.
+func (lib *library) findPages(name, section string, all bool) ([]pageRef, error) {
+    if section == "" {
+        if i := strings.LastIndex(name, "."); i > 0 && isSection(name[i+1:]) {
+            if refs, err := lib.findPages(name[:i], name[i+1:], all); err == nil {
+                return refs, nil
+            }
+        }
+    }
+
+    sections := lib.searchSections()
+    if section != "" {
+        sections = appendUnique([]string{section}, sections...)
+    }
+
+    // Look on disk rather than in the index, which may not list a page
+    // added to an earlier root since it was built.
+    var refs []pageRef
+    found := make(map[string]bool)
+    for _, s := range sections {
+        ref, ok := lib.findInSection(name, s)
+        if !ok || found[ref.section] || section != "" && ref.section != section {
+            continue
+        }
+        found[ref.section] = true
+        refs = append(refs, ref)
+        if !all {
+            break
+        }
+    }
+    if len(refs) > 0 {
+        return refs, nil
+    }
+
+    // A page may also go by the name or an alias given in its front matter.
+    if lib.index != nil {
+        refs = lib.index.metaNamed(name, section, lib.index.selected(lib.v))
+        if len(refs) > 1 && !all {
+            refs = refs[:1]
+        }
+        if len(refs) > 0 {
+            return refs, nil
+        }
+    }
+    return nil, os.ErrNotExist
+}
+
+// findInSection returns the first page in the gmanN directory of section
+// found on disk whose front matter does not name another os. The page is in
+// the section its front matter gives, if any.
+// Within a section the os and lang variants are tried in order, and an os
+// match is preferred over a lang match, so an English page for the running
+// system beats a translated page for another one. Compressed pages are
+// preferred within a root.
+func (lib *library) findInSection(name, section string) (pageRef, bool) {
+    for _, osname := range lib.v.oses {
+        for _, lang := range lib.v.langs {
+            for _, root := range lib.roots {
+                dir := filepath.Join(root, osname, lang, "gman"+section)
+                for _, file := range pageFileNames(name, section) {
+                    path := filepath.Join(dir, file)
+                    if lib.isFile(path) {
+                        ref := pageRef{name: name, section: section, os: osname, lang: lang, path: path}
+                        if lib.applyFrontMatter(&ref) {
+                            return ref, true
+                        }
+                    }
+                }
+            }
+        }
+    }
+    return pageRef{}, false
+}
+
+// allPages returns every page file under the roots, in roots order, for all
+// os and lang directories and sections.
+func (lib *library) allPages() []pageRef {
+    var refs []pageRef
+    for _, root := range lib.roots {
+        for _, path := range lib.glob(root, "*/*/gman*/*") {
+            section := strings.TrimPrefix(filepath.Base(filepath.Dir(path)), "gman")
+            name, ok := pageFileName(filepath.Base(path), section)
+            if !isSection(section) || !ok {
+                continue
+            }
+            langdir := filepath.Dir(filepath.Dir(path))
+            refs = append(refs, pageRef{
+                name:    name,
+                section: section,
+                os:      filepath.Base(filepath.Dir(langdir)),
+                lang:    filepath.Base(langdir),
+                path:    path,
+            })
+        }
+    }
+    return refs
+}
+
+// pageFileName returns the page name of a file in section, such as "gman"
+// for "gman.1.md", "gman.1.md.gz" or "gman.1.gz", and whether the file is a
+// page at all.
+func pageFileName(file, section string) (string, bool) {
+    base := strings.TrimSuffix(file, compressionExt(file))
+    if base == file && !strings.HasSuffix(file, ".md") {
+        return "", false
+    }
+    base = strings.TrimSuffix(base, ".md")
+    suffix := "." + section
+    if !strings.HasSuffix(base, suffix) || len(base) == len(suffix) {
+        return "", false
+    }
+    return strings.TrimSuffix(base, suffix), true
+}
+
+// readPage returns the contents of the page, decompressing or converting it
+// if needed, unless lookup has already read them. A page that cannot be
+// decompressed gives a *corruptPageError.
+func (lib *library) readPage(ref pageRef) ([]byte, error) {
+    if ref.input != nil {
+        return ref.input, nil
+    }
+    switch ref.source {
+    case "man":
+        return readManPage(ref.path)
+    case "help":
+        return readHelpPage(ref)
+    }
+    f, err := lib.open(ref.path)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+    ext := compressionExt(ref.path)
+    if ext == "" {
+        return io.ReadAll(f)
+    }
+    return decompress(f, ref.path, ext)
+}
+
+// applyFrontMatter moves ref to the section its front matter gives and
+// reports whether the page is for the os of the directory it is in, which
+// may be a fallback for the os asked for. A page that cannot be
+// read is taken as it is; reading it will fail again and say why.
+func (lib *library) applyFrontMatter(ref *pageRef) bool {
+    meta, err := lib.readFrontMatter(ref)
+    if err != nil {
+        return true
+    }
+    if meta.Section != "" {
+        ref.section = meta.Section
+    }
+    return forOS(meta.OS, lib.v.pageOS(ref.os))
+}
+
+// readFrontMatter returns the front matter of the page at ref. Of a page
+// that is not compressed, only the lines up to the end of the front matter
+// are read; any other page is read whole and kept in ref.
+func (lib *library) readFrontMatter(ref *pageRef) (mandown.Meta, error) {
+    var head []byte
+    if ref.input != nil || ref.source != "" || compressionExt(ref.path) != "" {
+        input, err := lib.readPage(*ref)
+        if err != nil {
+            return mandown.Meta{}, err
+        }
+        ref.input, head = input, input
+    } else {
+        f, err := lib.open(ref.path)
+        if err != nil {
+            return mandown.Meta{}, err
+        }
+        defer f.Close()
+        r := bufio.NewReader(f)
+        for n := 0; ; n++ {
+            line, err := r.ReadString('\n')
+            head = append(head, line...)
+            delim := strings.TrimRight(line, " \t\r\n")
+            if err != nil || n == 0 && delim != "---" || n > 0 && (delim == "---" || delim == "...") {
+                break
+            }
+        }
+    }
+    meta, _, _ := mandown.SplitFrontMatter(head)
+    return meta, nil
+}
+
+// splitPage separates the front matter of a page from its body. Malformed
+// front matter is logged and what could be read of it is used.
+func splitPage(ref pageRef, input []byte) (mandown.Meta, []byte) {
+    meta, body, err := mandown.SplitFrontMatter(input)
+    if err != nil {
+        log.Println("Error in", ref.path, ":", err)
+    }
+    return meta, body
+}
+
+// readError describes why the page could not be read, telling a missing
+// page apart from one that is unreadable or corrupt.
+func readError(ref pageRef, err error) string {
+    if os.IsNotExist(err) {
+        return "gman: help page " + ref.name + " not found"
+    }
+    return "gman: cannot read help page " + ref.name + ": " + err.Error()
+}
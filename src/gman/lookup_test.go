@@ -0,0 +1,586 @@
+package main
+
+import (
+    "archive/tar"
+    "bytes"
+    "compress/gzip"
+    "io/fs"
+    "os"
+    "os/user"
+    "path/filepath"
+    "strings"
+    "testing"
+    "testing/fstest"
+)
+
+func gzipped(t *testing.T, s string) []byte {
+    var buf bytes.Buffer
+    zw := gzip.NewWriter(&buf)
+    if _, err := zw.Write([]byte(s)); err != nil {
+        t.Fatal(err)
+    }
+    if err := zw.Close(); err != nil {
+        t.Fatal(err)
+    }
+    return buf.Bytes()
+}
+
+func testLibrary(stores ...fstest.MapFS) *library {
+    lib := &library{
+        stores: make(map[string]fs.FS),
+        order:  defaultSections,
+        v:      variants{oses: []string{"linux", "generic"}, langs: []string{"pt", "en"}},
+    }
+    for i, store := range stores {
+        root := filepath.Join(string(filepath.Separator), "root"+string(rune('a'+i)))
+        lib.roots = append(lib.roots, root)
+        lib.stores[root] = store
+    }
+    return lib
+}
+
+func page(s string) *fstest.MapFile {
+    return &fstest.MapFile{Data: []byte(s)}
+}
+
+func TestLookup_FindPages(t *testing.T) {
+    lib := testLibrary(
+        fstest.MapFS{
+            "generic/en/gman1/ls.1.md":      page("# ls generic"),
+            "linux/en/gman7/ls.7.md":        page("# ls 7"),
+            "linux/en/gman3p/tar.3p.md":     page("# tar 3p"),
+            "osx/pt/gman1/cp.1.md":          page("# cp osx"),
+            "linux/en/gman1/gzip.1.md":      page("# gzip plain"),
+            "linux/en/gman1/gzip.1.md.gz":   &fstest.MapFile{Data: gzipped(t, "# gzip")},
+            "linux/en/gman8/mount.8.md":     page("# mount a"),
+            "linux/en/gman1/notapage.1.txt": page("text"),
+        },
+        fstest.MapFS{
+            "linux/en/gman1/ls.1.md":    page("# ls linux"),
+            "linux/pt/gman8/mount.8.md": page("# mount b"),
+        },
+    )
+
+    tests := []struct {
+        name, section string
+        all           bool
+        want          []string
+    }{
+        // An os match beats an earlier root.
+        {"ls", "", false, []string{"/rootb/linux/en/gman1/ls.1.md"}},
+        {"ls", "7", false, []string{"/roota/linux/en/gman7/ls.7.md"}},
+        {"ls.7", "", false, []string{"/roota/linux/en/gman7/ls.7.md"}},
+        {"ls", "", true, []string{"/rootb/linux/en/gman1/ls.1.md", "/roota/linux/en/gman7/ls.7.md"}},
+        // Sections missing from the order are searched last.
+        {"tar", "", false, []string{"/roota/linux/en/gman3p/tar.3p.md"}},
+        {"gzip", "", false, []string{"/roota/linux/en/gman1/gzip.1.md.gz"}},
+        // A preferred lang beats an earlier root.
+        {"mount", "", false, []string{"/rootb/linux/pt/gman8/mount.8.md"}},
+        {"cp", "", false, nil},
+        {"notapage", "", false, nil},
+    }
+    for _, tt := range tests {
+        refs, err := lib.findPages(tt.name, tt.section, tt.all)
+        if len(tt.want) == 0 {
+            if err == nil {
+                t.Errorf("findPages(%q, %q) = %v, want not found", tt.name, tt.section, refs)
+            }
+            continue
+        }
+        var got []string
+        for _, ref := range refs {
+            got = append(got, filepath.ToSlash(ref.path))
+        }
+        if len(got) != len(tt.want) {
+            t.Errorf("findPages(%q, %q, %v) = %q, want %q", tt.name, tt.section, tt.all, got, tt.want)
+            continue
+        }
+        for i := range got {
+            if got[i] != tt.want[i] {
+                t.Errorf("findPages(%q, %q, %v) = %q, want %q", tt.name, tt.section, tt.all, got, tt.want)
+                break
+            }
+        }
+    }
+}
+
+func TestLookup_ReadPage(t *testing.T) {
+    lib := testLibrary(fstest.MapFS{
+        "linux/en/gman1/good.1.md.gz": &fstest.MapFile{Data: gzipped(t, "# good")},
+        "linux/en/gman1/bad.1.md.gz":  page("not gzip"),
+    })
+
+    refs, err := lib.findPages("good", "", false)
+    if err != nil {
+        t.Fatal("good not found:", err)
+    }
+    input, err := lib.readPage(refs[0])
+    if err != nil || string(input) != "# good" {
+        t.Errorf("readPage(good) = %q, %v, want %q", input, err, "# good")
+    }
+
+    refs, err = lib.findPages("bad", "", false)
+    if err != nil {
+        t.Fatal("bad not found:", err)
+    }
+    if _, err := lib.readPage(refs[0]); err == nil {
+        t.Error("readPage(bad) succeeded, want corrupt archive error")
+    } else if _, ok := err.(*corruptPageError); !ok {
+        t.Errorf("readPage(bad) error = %v, want corrupt archive error", err)
+    }
+}
+
+func TestLookup_AllPages(t *testing.T) {
+    lib := testLibrary(fstest.MapFS{
+        "linux/en/gman1/a.1.md":     page("# a"),
+        "linux/en/gman1/b.1.gz":     page(""),
+        "linux/en/gman1/c.1.md.bz2": page(""),
+        "linux/en/gman1/logo.png":   page(""),
+        "osx/pt/gman7/d.7.md":       page("# d"),
+    })
+
+    var got []string
+    for _, ref := range lib.allPages() {
+        got = append(got, ref.name+"("+ref.section+") "+ref.os+"/"+ref.lang)
+    }
+    want := []string{"a(1) linux/en", "b(1) linux/en", "c(1) linux/en", "d(7) osx/pt"}
+    if len(got) != len(want) {
+        t.Fatalf("allPages = %q, want %q", got, want)
+    }
+    for i := range want {
+        if got[i] != want[i] {
+            t.Errorf("page %d = %q, want %q", i, got[i], want[i])
+        }
+    }
+}
+
+func TestLookup_BuiltinPages(t *testing.T) {
+    store, err := openStore(builtinRoot)
+    if err != nil {
+        t.Fatal("Error opening built-in pages:", err)
+    }
+    if _, err := fs.Stat(store, "linux/en/gman1/gman.1.md"); err != nil {
+        t.Error("gman(1) is not built in:", err)
+    }
+}
+
+func TestLookup_Packs(t *testing.T) {
+    dir := t.TempDir()
+    var buf bytes.Buffer
+    zw := gzip.NewWriter(&buf)
+    tw := tar.NewWriter(zw)
+    for name, body := range map[string]string{
+        "linux/en/gman1/foo.1.md": "# foo",
+        "linux/en/gman1/bar.1.md": "# bar",
+    } {
+        tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(body)), Typeflag: tar.TypeReg})
+        tw.Write([]byte(body))
+    }
+    tw.Close()
+    zw.Close()
+    good := filepath.Join(dir, "good.tar.gz")
+    bad := filepath.Join(dir, "bad.tar.gz")
+    os.WriteFile(good, buf.Bytes(), 0644)
+    os.WriteFile(bad, []byte("not gzip"), 0644)
+
+    lib := &library{stores: make(map[string]fs.FS), order: defaultSections,
+        v: variants{oses: []string{"linux"}, langs: []string{"en"}}}
+    for _, root := range []string{bad, good} {
+        store, err := openStore(root)
+        if err != nil {
+            t.Fatal("Error opening help pack:", err)
+        }
+        lib.roots = append(lib.roots, root)
+        lib.stores[root] = store
+    }
+    if lib.stores[good].(*lazyPack).fsys != nil {
+        t.Error("help pack was opened before it was used")
+    }
+
+    refs, err := lib.findPages("foo", "", false)
+    if err != nil {
+        t.Fatal("foo not found:", err)
+    }
+    input, err := lib.readPage(refs[0])
+    if err != nil || string(input) != "# foo" {
+        t.Errorf("readPage(foo) = %q, %v, want %q", input, err, "# foo")
+    }
+    if got := len(lib.allPages()); got != 2 {
+        t.Errorf("allPages found %d pages, want 2", got)
+    }
+}
+
+func TestLookup_Redirects(t *testing.T) {
+    lib := testLibrary(fstest.MapFS{
+        "linux/en/gman1/gzip.1.md":     page("# gzip(1) - compress files"),
+        "linux/en/gman1/oldzip.1.md":   page(".so gzip(1)\n"),
+        "linux/en/gman1/olderzip.1.md": page(".so gman1/oldzip.1.md\n"),
+        "linux/en/gman1/loopa.1.md":    page(".so loopb.1"),
+        "linux/en/gman1/loopb.1.md":    page(".so loopa"),
+        "linux/en/gman1/dangling.1.md": page(".so nowhere(1)"),
+        "linux/en/gman1/big.1.md":      page("# big\n\n" + strings.Repeat("text ", maxStubSize)),
+    })
+
+    refs, err := lib.lookup("olderzip", "", false)
+    if err != nil {
+        t.Fatal("lookup(olderzip) returned error:", err)
+    }
+    if refs[0].name != "gzip" || refs[0].redirectedFrom != "olderzip" {
+        t.Errorf("lookup(olderzip) = %+v, want gzip redirected from olderzip", refs[0])
+    }
+    // The page read to see whether it is a stub is not read again; one too
+    // big to be a stub is not read at all.
+    if string(refs[0].input) != "# gzip(1) - compress files" {
+        t.Errorf("lookup(olderzip) kept %q, want the page read", refs[0].input)
+    }
+    if refs, err := lib.lookup("big", "", false); err != nil || refs[0].input != nil {
+        t.Errorf("lookup(big) = %v, %v, want the page unread", refs, err)
+    }
+    for _, name := range []string{"loopa", "dangling"} {
+        if _, err := lib.lookup(name, "", false); err == nil || err == fs.ErrNotExist {
+            t.Errorf("lookup(%s) error = %v, want a redirect error", name, err)
+        }
+    }
+
+    got := string(markRedirect([]byte("# gzip(1) - compress files\n\nbody\n"), "oldzip"))
+    if want := "# gzip(1) - compress files (redirected from oldzip)\n\nbody\n"; got != want {
+        t.Errorf("markRedirect = %q, want %q", got, want)
+    }
+}
+
+func TestLookup_Subcommands(t *testing.T) {
+    lib := testLibrary(fstest.MapFS{
+        "linux/en/gman1/git.1.md":     page("# git\n## Commands\n### commit\nRecord.\n### remote\n#### add\nAdd.\n"),
+        "linux/en/gman1/git-log.1.md": page("# git-log\n"),
+    })
+
+    tests := []struct {
+        words            string
+        page, subs, args string
+    }{
+        {"git log --oneline", "git-log", "", "--oneline"},
+        {"git remote add -v", "git", "remote add", "-v"},
+        {"git -C path", "git", "", "-C path"},
+    }
+    for _, tt := range tests {
+        refs, subs, args, err := lib.lookupCommand(strings.Fields(tt.words), "", false)
+        if err != nil {
+            t.Errorf("lookupCommand(%q) returned error: %v", tt.words, err)
+            continue
+        }
+        if refs[0].name != tt.page || strings.Join(subs, " ") != tt.subs || strings.Join(args, " ") != tt.args {
+            t.Errorf("lookupCommand(%q) = %s, %q, %q, want %s, %q, %q",
+                tt.words, refs[0].name, subs, args, tt.page, tt.subs, tt.args)
+        }
+    }
+
+    input, _ := lib.readPage(pageRef{path: filepath.Join(lib.roots[0], "linux/en/gman1/git.1.md")})
+    if got, ok := subcommandSection(input, "git", []string{"remote", "add"}); !ok || string(got) != "#### add\nAdd." {
+        t.Errorf("subcommandSection(remote add) = %q, %v", got, ok)
+    }
+    if _, ok := subcommandSection(input, "git", []string{"push"}); ok {
+        t.Error("subcommandSection(push) found a section")
+    }
+}
+
+func TestLookup_StaleIndex(t *testing.T) {
+    earlier := fstest.MapFS{}
+    lib := testLibrary(earlier, fstest.MapFS{"linux/en/gman1/foo.1.md": page("# foo b")})
+    lib.index = &pageIndex{Version: indexVersion}
+    lib.index.update(lib)
+
+    // A page added to an earlier root after the index was built wins.
+    earlier["linux/en/gman1/foo.1.md"] = page("# foo a")
+    refs, err := lib.findPages("foo", "", false)
+    if err != nil || len(refs) != 1 || refs[0].path != "/roota/linux/en/gman1/foo.1.md" {
+        t.Errorf("findPages(foo) = %v, %v, want the page in the earlier root", refs, err)
+    }
+}
+
+func TestLookup_FrontMatterOS(t *testing.T) {
+    lib := testLibrary(
+        fstest.MapFS{"generic/en/gman1/open.1.md": page("---\nos: [darwin]\n---\n# open osx")},
+        fstest.MapFS{"generic/en/gman1/open.1.md": page("---\nos: [linux]\n---\n# open linux")},
+    )
+    lib.index = &pageIndex{Version: indexVersion}
+    lib.index.update(lib)
+
+    // A page for another os is passed over for one in a later root.
+    refs, err := lib.findPages("open", "", false)
+    if err != nil || len(refs) != 1 || refs[0].path != "/rootb/generic/en/gman1/open.1.md" {
+        t.Errorf("findPages(open) = %v, %v, want the linux page", refs, err)
+    }
+    sel := lib.index.selected(lib.v)
+    if len(sel) != 1 || lib.index.Entries[sel[0]].Path != "/rootb/generic/en/gman1/open.1.md" {
+        t.Errorf("selected = %v, want only the linux page", sel)
+    }
+
+    // A page found by falling back to another os may be for that os.
+    lib = testLibrary(fstest.MapFS{"linux/en/gman1/free.1.md": page("---\nos: [linux]\n---\n# free")})
+    lib.v.oses = []string{"osx", "generic", "linux"}
+    if refs, err := lib.findPages("free", "", false); err != nil || refs[0].os != "linux" {
+        t.Errorf("findPages(free) on osx = %v, %v, want the linux page", refs, err)
+    }
+}
+
+func TestLookup_FrontMatterSection(t *testing.T) {
+    lib := testLibrary(fstest.MapFS{
+        "linux/en/gman1/mkfs.1.md": page("---\nsection: 8\n---\n# mkfs"),
+    })
+    lib.index = &pageIndex{Version: indexVersion}
+    lib.index.update(lib)
+
+    refs, err := lib.findPages("mkfs", "8", false)
+    if err != nil || refs[0].section != "8" {
+        t.Errorf("findPages(mkfs, 8) = %v, %v, want the page in section 8", refs, err)
+    }
+    if refs, err := lib.findPages("mkfs", "1", false); err == nil {
+        t.Errorf("findPages(mkfs, 1) = %v, want not found", refs)
+    }
+    if got := lib.index.Entries[0].Section; got != "8" {
+        t.Errorf("index entry section = %q, want %q", got, "8")
+    }
+}
+
+func TestLookup_Apropos(t *testing.T) {
+    summaries := []pageSummary{
+        {pageRef{name: "zgrep", section: "1"}, "search compressed files", nil, nil},
+        {pageRef{name: "grep", section: "1"}, "print lines that match patterns", nil, nil},
+        {pageRef{name: "tar", section: "1"}, "archiver", []string{"grep-friendly"}, nil},
+        {pageRef{name: "grepdiff", section: "1"}, "show diffs that match", nil, nil},
+        {pageRef{name: "Grep", section: "3"}, "the grep library", nil, nil},
+        {pageRef{name: "find", section: "1"}, "find files; see grep", nil, nil},
+        {pageRef{name: "foo", section: "1"}, "does foo things", nil, []string{"bar"}},
+        {pageRef{name: "ls", section: "1"}, "list directory contents", nil, nil},
+    }
+
+    tests := []struct {
+        expr string
+        want []string
+    }{
+        // Exact names first, then names starting with a match, other
+        // names and finally descriptions and tags, ignoring case.
+        {"grep", []string{"grep(1)", "Grep(3)", "grepdiff(1)", "zgrep(1)", "find(1)", "tar(1)"}},
+        {"^l", []string{"ls(1)"}},
+        // An alias is found like a name.
+        {"bar", []string{"foo(1)"}},
+        {"nothing", nil},
+    }
+    for _, tt := range tests {
+        matches, err := apropos(summaries, tt.expr)
+        if err != nil {
+            t.Errorf("apropos(%q) returned error: %v", tt.expr, err)
+            continue
+        }
+        var got []string
+        for _, m := range matches {
+            got = append(got, m.name+"("+m.section+")")
+        }
+        if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+            t.Errorf("apropos(%q) = %q, want %q", tt.expr, got, tt.want)
+        }
+    }
+
+    if _, err := apropos(summaries, "("); err == nil || !strings.Contains(err.Error(), "bad apropos regex") {
+        t.Errorf("apropos(\"(\") error = %v, want bad regex error", err)
+    }
+}
+
+func TestLookup_GmanPath(t *testing.T) {
+    usr, err := user.Current()
+    if err != nil {
+        t.Skip("no home directory:", err)
+    }
+    home := usr.HomeDir
+    rel, _ := filepath.Abs("rel")
+    configured := map[string]interface{}{"gmanpath": []interface{}{"/team", "~/pages", "/team"}}
+
+    tests := []struct {
+        env  string
+        opts map[string]interface{}
+        want []string
+    }{
+        // The config key, as an array or a colon separated string, with
+        // home directories expanded, relative roots made absolute and
+        // repeats dropped.
+        {"", configured, []string{"/team", filepath.Join(home, "pages")}},
+        {"", map[string]interface{}{"gmanpath": "/a:rel:/a"}, []string{"/a", rel}},
+        {"", map[string]interface{}{}, nil},
+        // GMANPATH comes first; an empty component stands for the config.
+        {"/mine:/system", configured, []string{"/mine", "/system"}},
+        {"/mine:", configured, []string{"/mine", "/team", filepath.Join(home, "pages")}},
+        {":/system:/team", configured, []string{"/team", filepath.Join(home, "pages"), "/system"}},
+    }
+    for _, tt := range tests {
+        t.Setenv("GMANPATH", tt.env)
+        got := gmanPath(tt.opts)
+        if strings.Join(got, ":") != strings.Join(tt.want, ":") {
+            t.Errorf("gmanPath with GMANPATH=%q and %v = %q, want %q", tt.env, tt.opts, got, tt.want)
+        }
+    }
+}
+
+func TestLookup_LangChain(t *testing.T) {
+    tests := []struct {
+        locale, want string
+    }{
+        {"pt_BR.UTF-8", "pt_BR pt en"},
+        {"de_DE@euro", "de_DE de en"},
+        {"zh-tw", "zh_TW zh en"},
+        {"fr", "fr en"},
+        {"en_US.UTF-8", "en_US en"},
+        {"C", "en"},
+        {"POSIX", "en"},
+        {"", "en"},
+    }
+    for _, tt := range tests {
+        if got := strings.Join(langChain(tt.locale), " "); got != tt.want {
+            t.Errorf("langChain(%q) = %q, want %q", tt.locale, got, tt.want)
+        }
+    }
+
+    // The locale is taken from LC_ALL, then LC_MESSAGES and then LANG.
+    t.Setenv("LC_ALL", "")
+    t.Setenv("LC_MESSAGES", "pt_BR.UTF-8")
+    t.Setenv("LANG", "de_DE.UTF-8")
+    v := pageVariants(map[string]interface{}{"os": "osx"})
+    if got := strings.Join(v.langs, " "); got != "pt_BR pt en" {
+        t.Errorf("langs from LC_MESSAGES = %q, want %q", got, "pt_BR pt en")
+    }
+    if got := strings.Join(v.oses, " "); got != "osx generic linux" {
+        t.Errorf("oses for osx = %q, want %q", got, "osx generic linux")
+    }
+    v = pageVariants(map[string]interface{}{"os": "linux", "lang": "fr", "os-fallback": []interface{}{"generic"}})
+    if got := strings.Join(v.oses, " ") + "/" + strings.Join(v.langs, " "); got != "linux generic/fr en" {
+        t.Errorf("variants from config = %q, want %q", got, "linux generic/fr en")
+    }
+}
+
+func TestLookup_OSFallback(t *testing.T) {
+    lib := testLibrary(fstest.MapFS{
+        "osx/en/gman1/open.1.md":    page("# open"),
+        "generic/en/gman1/ls.1.md":  page("# ls"),
+        "linux/en/gman1/ls.1.md":    page("# ls linux"),
+        "linux/en/gman1/free.1.md":  page("# free"),
+        "linux/pt/gman1/free.1.md":  page("# free pt"),
+        "linux/de/gman1/chmod.1.md": page("# chmod de"),
+    })
+    lib.v = variants{oses: osChain("osx", defaultOSFallback), langs: langChain("pt_BR")}
+
+    tests := []struct {
+        name, want, notice string
+    }{
+        // A missing osx page falls back to generic and then linux, and a
+        // missing pt_BR one to pt and then en, with a notice.
+        {"open", "osx/en", "no pt_BR page for *open* was found; showing the en page."},
+        {"ls", "generic/en", "no osx/pt_BR page for *ls* was found; showing the generic/en page."},
+        {"free", "linux/pt", "no osx page for *free* was found; showing the linux page."},
+        {"chmod", "", ""},
+    }
+    for _, tt := range tests {
+        refs, err := lib.findPages(tt.name, "", false)
+        if tt.want == "" {
+            if err == nil {
+                t.Errorf("findPages(%s) = %v, want not found", tt.name, refs)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("findPages(%s) returned error: %v", tt.name, err)
+            continue
+        }
+        if got := refs[0].os + "/" + refs[0].lang; got != tt.want {
+            t.Errorf("findPages(%s) found %s, want %s", tt.name, got, tt.want)
+        }
+        notice := variantNotice(refs[0], lib.v)
+        if !strings.Contains(notice, tt.notice) {
+            t.Errorf("variantNotice(%s) = %q, want %q", tt.name, notice, tt.notice)
+        }
+    }
+
+    // pt_BR and pt are one language.
+    if pt := variantNotice(pageRef{name: "ls", os: "osx", lang: "pt"}, lib.v); pt != "" {
+        t.Errorf("variantNotice(pt page) = %q, want none", pt)
+    }
+    if man := variantNotice(pageRef{name: "ls", source: "man"}, lib.v); !strings.Contains(man, "system man page") {
+        t.Errorf("variantNotice(man page) = %q", man)
+    }
+}
+
+func TestLookup_ManFallback(t *testing.T) {
+    dir := t.TempDir()
+    roff := ".TH TAR 1\n.SH NAME\ntar \\- an archiver\n"
+    for name, data := range map[string][]byte{
+        "man1/git-commit.1": []byte(".TH GIT-COMMIT 1\n.SH NAME\ngit-commit \\- record changes\n"),
+        "man1/tar.1.gz":     gzipped(t, roff),
+        "man1/broken.1.gz":  []byte("not gzip"),
+        "man8/mount.8":      []byte(".TH MOUNT 8\n"),
+    } {
+        file := filepath.Join(dir, filepath.FromSlash(name))
+        os.MkdirAll(filepath.Dir(file), 0755)
+        os.WriteFile(file, data, 0644)
+    }
+    t.Setenv("MANPATH", dir)
+    lib := testLibrary()
+
+    // Man pages are tried unless another source is asked for.
+    for source, want := range map[string]bool{"": true, "man": true, "gman": false, "help": false} {
+        if got := triesMan(source); got != want {
+            t.Errorf("triesMan(%q) = %v, want %v", source, got, want)
+        }
+    }
+
+    tests := []struct {
+        words, section   string
+        page, subs, args string
+    }{
+        {"git commit -v", "", "git-commit", "", "-v"},
+        {"tar x -f", "", "tar", "x", "-f"},
+        {"mount", "8", "mount", "", ""},
+        {"tar", "8", "", "", ""},
+        {"nosuch", "", "", "", ""},
+    }
+    for _, tt := range tests {
+        refs, subs, args, err := lib.lookupManCommand(strings.Fields(tt.words), tt.section)
+        if tt.page == "" {
+            if err != os.ErrNotExist {
+                t.Errorf("lookupManCommand(%q, %q) = %v, %v, want not found", tt.words, tt.section, refs, err)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("lookupManCommand(%q) returned error: %v", tt.words, err)
+            continue
+        }
+        if refs[0].name != tt.page || refs[0].source != "man" ||
+            strings.Join(subs, " ") != tt.subs || strings.Join(args, " ") != tt.args {
+            t.Errorf("lookupManCommand(%q) = %+v, %q, %q, want %s, %q, %q",
+                tt.words, refs[0], subs, args, tt.page, tt.subs, tt.args)
+        }
+    }
+
+    // A man page is converted when read; one that cannot be read is an
+    // error that says so.
+    refs, _, _, err := lib.lookupManCommand([]string{"tar"}, "")
+    if err != nil {
+        t.Fatal("tar not found:", err)
+    }
+    if input, err := lib.readPage(refs[0]); err != nil || !strings.Contains(string(input), "an archiver") {
+        t.Errorf("readPage(tar) = %q, %v, want the converted page", input, err)
+    }
+    refs, _, _, err = lib.lookupManCommand([]string{"broken"}, "")
+    if err != nil {
+        t.Fatal("broken not found:", err)
+    }
+    if _, err := lib.readPage(refs[0]); err == nil {
+        t.Error("readPage(broken) succeeded, want corrupt archive error")
+    } else if _, ok := err.(*corruptPageError); !ok {
+        t.Errorf("readPage(broken) error = %v, want corrupt archive error", err)
+    }
+
+    // Without man pages nothing is found.
+    t.Setenv("MANPATH", filepath.Join(dir, "missing"))
+    if _, _, _, err := lib.lookupManCommand([]string{"tar"}, ""); err != os.ErrNotExist {
+        t.Errorf("lookupManCommand(tar) with no man pages error = %v, want not found", err)
+    }
+}
@@ -0,0 +1,129 @@
+// Copyright 2014 The Gman Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in LICENSE file.
+
+package main
+
+import (
+    "bytes"         // for holding converted pages
+    "io"            // for reading man pages
+    "log"           // for debug logging
+    "man2md"        // for converting man pages
+    "os"            // for reading MANPATH
+    "path/filepath" // for building man page paths
+    "strings"       // for string manipulation
+)
+
+// defaultManPath is searched for system man pages when MANPATH is unset.
+var defaultManPath = []string{"/usr/local/share/man", "/usr/share/man", "/usr/local/man"}
+
+// manPath returns the directories holding system man pages, from MANPATH
+// if set. An empty MANPATH element stands for the default directories.
+func manPath() []string {
+    env := os.Getenv("MANPATH")
+    if env == "" {
+        return defaultManPath
+    }
+    var dirs []string
+    for _, dir := range filepath.SplitList(env) {
+        if dir == "" {
+            dirs = append(dirs, defaultManPath...)
+        } else {
+            dirs = append(dirs, dir)
+        }
+    }
+    return dirs
+}
+
+// findManPage returns the path of the system man page for name. An empty
+// section searches the sections in order, then any other section. Pages
+// such as "openssl.1ssl.gz" are found in section 1.
+func findManPage(name, section string, order []string) (string, bool) {
+    sections := []string{section}
+    if section == "" {
+        sections = append(append([]string(nil), order...), "*")
+    }
+    for _, s := range sections {
+        for _, dir := range manPath() {
+            files, _ := filepath.Glob(filepath.Join(dir, "man"+s, name+".*"))
+            for _, file := range files {
+                ext := manSection(name, file)
+                if isSection(ext) && (s == "*" || strings.HasPrefix(ext, s)) {
+                    return file, true
+                }
+            }
+        }
+    }
+    return "", false
+}
+
+// manSection returns the section a man page file for name is in, such as
+// "1ssl" for "openssl.1ssl.gz".
+func manSection(name, file string) string {
+    base := filepath.Base(file)
+    return strings.TrimPrefix(strings.TrimSuffix(base, compressionExt(base)), name+".")
+}
+
+// findManRef returns the system man page for name as a page, or false if
+// there is none.
+func (lib *library) findManRef(name, section string) (pageRef, bool) {
+    if section == "" {
+        if i := strings.LastIndex(name, "."); i > 0 && isSection(name[i+1:]) {
+            if ref, ok := lib.findManRef(name[:i], name[i+1:]); ok {
+                return ref, true
+            }
+        }
+    }
+    file, ok := findManPage(name, section, lib.order)
+    if !ok {
+        return pageRef{}, false
+    }
+    return pageRef{name: name, section: manSection(name, file), path: file, source: "man"}, true
+}
+
+// triesMan reports whether the system man pages are searched when there is
+// no gman page, given the page source --query asks for: they are unless
+// another source than man is asked for.
+func triesMan(source string) bool {
+    return source == "" || source == "man"
+}
+
+// lookupManCommand is lookupCommand for the system man pages: the man page
+// for a subcommand, such as git-commit for "git commit", is preferred to
+// the command's.
+func (lib *library) lookupManCommand(words []string, section string) (refs []pageRef, subs, args []string, err error) {
+    n := commandWords(words)
+    for i, name := range subcommandPages(words) {
+        if ref, ok := lib.findManRef(name, section); ok {
+            log.Println("Using man page", ref.path)
+            return []pageRef{ref}, words[n-i : n], words[n:], nil
+        }
+    }
+    if ref, ok := lib.findManRef(words[0], section); ok {
+        log.Println("Using man page", ref.path)
+        return []pageRef{ref}, words[1:n], words[n:], nil
+    }
+    return nil, nil, nil, os.ErrNotExist
+}
+
+// readManPage returns the man page at path converted to Markdown.
+func readManPage(path string) ([]byte, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+    var r io.Reader = f
+    if ext := compressionExt(path); ext != "" {
+        input, err := decompress(f, path, ext)
+        if err != nil {
+            return nil, err
+        }
+        r = bytes.NewReader(input)
+    }
+    var buf bytes.Buffer
+    if err := man2md.Convert(r, &buf); err != nil {
+        return nil, err
+    }
+    return buf.Bytes(), nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2014 The Gman Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in LICENSE file.
+
+package main
+
+import (
+    "errors"  // for reporting errors
+    "mandown" // for finding the Options section
+    "strings" // for string manipulation
+)
+
+// optionEntry is one documented option from a page's Options section, such
+// as the "#### -b, --browse" heading and the text below it.
+type optionEntry struct {
+    names    []string        // option names, e.g. "-b" and "--browse"
+    takesArg map[string]bool // names documented with an argument
+    lines    []string        // the entry's Markdown, heading included
+}
+
+// optionEntries returns the entries under the page's Options sections. Each
+// heading nested in a section starts a new entry. A page without an Options
+// section has an entry for each heading that starts with an option name.
+func optionEntries(input []byte) []optionEntry {
+    var entries []optionEntry
+    doc := mandown.Parse(input)
+    headings := doc.Headings()
+    var end = 0
+    for i, h := range headings {
+        if h.Start < end || !strings.EqualFold(h.Title, "options") {
+            continue
+        }
+        end = doc.SectionEnd(h)
+        for j := i + 1; j < len(headings) && headings[j].Start < end; j++ {
+            entry := parseOptionHeading(headings[j].Title)
+            entryEnd := end
+            if j+1 < len(headings) && headings[j+1].Start < end {
+                entryEnd = headings[j+1].Start
+            }
+            entry.lines = doc.Lines[headings[j].Start:entryEnd]
+            entries = append(entries, entry)
+        }
+    }
+    if end > 0 {
+        return entries
+    }
+
+    // Without an Options section, as in a subcommand's part of a page, any
+    // heading naming options is an entry.
+    for i, h := range headings {
+        entry := parseOptionHeading(h.Title)
+        if len(entry.names) == 0 || !strings.HasPrefix(strings.TrimLeft(h.Title, "*`_"), "-") {
+            continue
+        }
+        entryEnd := doc.SectionEnd(h)
+        if i+1 < len(headings) && headings[i+1].Start < entryEnd {
+            entryEnd = headings[i+1].Start
+        }
+        entry.lines = doc.Lines[h.Start:entryEnd]
+        entries = append(entries, entry)
+    }
+    return entries
+}
+
+// parseOptionHeading returns an entry holding the option names in a heading
+// such as "-k *regex*, --apropos *regex*" or "--color[=when]".
+func parseOptionHeading(heading string) optionEntry {
+    entry := optionEntry{takesArg: make(map[string]bool)}
+    heading = strings.NewReplacer("*", "", "_", " ", "`", "").Replace(heading)
+    for _, part := range strings.Split(heading, ",") {
+        fields := strings.Fields(part)
+        if len(fields) == 0 || !strings.HasPrefix(fields[0], "-") {
+            continue
+        }
+        name := fields[0]
+        arg := len(fields) > 1
+        if i := strings.IndexAny(name, "=["); i > 0 {
+            name = name[:i]
+            arg = true
+        }
+        entry.names = append(entry.names, name)
+        entry.takesArg[name] = arg
+    }
+    return entry
+}
+
+// extractOptions returns the Options entries documenting the options in
+// args, in command-line order, and the options that have no entry. Combined
+// short flags such as "-avm" are split unless documented as a whole, and
+// values given as "--opt=value" are ignored.
+func extractOptions(input []byte, args []string) ([]byte, []string, error) {
+    entries := optionEntries(input)
+    byName := make(map[string]int)
+    for i, entry := range entries {
+        for _, name := range entry.names {
+            if _, ok := byName[name]; !ok {
+                byName[name] = i
+            }
+        }
+    }
+
+    var blocks []string
+    var missing []string
+    shown := make(map[int]bool)
+    show := func(name string) bool {
+        i, ok := byName[name]
+        if !ok {
+            return false
+        }
+        if !shown[i] {
+            shown[i] = true
+            blocks = append(blocks, strings.Join(entries[i].lines, "\n"))
+        }
+        return true
+    }
+
+    for _, arg := range args {
+        if arg == "--" {
+            break
+        }
+        if !strings.HasPrefix(arg, "-") || arg == "-" {
+            // operands are not options
+            continue
+        }
+        if i := strings.Index(arg, "="); i > 0 {
+            arg = arg[:i]
+        }
+        if show(arg) {
+            continue
+        }
+        if strings.HasPrefix(arg, "--") || len(arg) == 2 {
+            missing = append(missing, arg)
+            continue
+        }
+        // Combined short flags. The rest of the word after a flag that
+        // takes an argument is that argument.
+        for _, c := range arg[1:] {
+            flag := "-" + string(c)
+            if !show(flag) {
+                missing = append(missing, flag)
+                continue
+            }
+            if entries[byName[flag]].takesArg[flag] {
+                break
+            }
+        }
+    }
+
+    if len(blocks) == 0 {
+        return nil, missing, errors.New("gman: no documented options found")
+    }
+    return []byte(strings.Join(blocks, "\n\n")), missing, nil
+}
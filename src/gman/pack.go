@@ -0,0 +1,253 @@
+// Copyright 2014 The Gman Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in LICENSE file.
+
+package main
+
+import (
+    "archive/tar"   // for reading tar help packs
+    "archive/zip"   // for reading zip help packs
+    "bytes"         // for holding pages read from tar packs
+    "compress/gzip" // for reading tar.gz help packs
+    "io"            // for reading pack contents
+    "io/fs"         // for reading pack contents
+    "log"           // for debug logging
+    "os"            // for local file access
+    "path"          // for names within packs
+    "sort"          // for ordering directory listings
+    "strings"       // for string manipulation
+    "sync"          // for opening packs once
+    "time"          // for file times
+)
+
+// packExts are the extensions of help packs: archives laid out like a page
+// root, with os/lang/gmanN directories at the top, that may be listed in the
+// search path in place of a directory.
+var packExts = []string{".zip", ".tar.gz", ".tgz"}
+
+// isPack reports whether root names a help pack rather than a directory.
+func isPack(root string) bool {
+    for _, ext := range packExts {
+        if strings.HasSuffix(root, ext) {
+            return true
+        }
+    }
+    return false
+}
+
+// lazyPack is a help pack that is opened the first time it is used, so
+// that runs which never look in it, such as --path or --complete with an
+// index, do not read it. A pack that cannot be opened has no files.
+type lazyPack struct {
+    file string
+    once sync.Once
+    fsys fs.FS
+    err  error
+}
+
+// store returns the contents of the pack, opening it if it is not yet.
+func (p *lazyPack) store() (fs.FS, error) {
+    p.once.Do(func() {
+        p.fsys, p.err = openPack(p.file)
+        if p.err != nil {
+            log.Println("Error opening help pack:", p.err)
+        }
+    })
+    return p.fsys, p.err
+}
+
+// Open opens a file of the pack.
+func (p *lazyPack) Open(name string) (fs.File, error) {
+    fsys, err := p.store()
+    if err != nil {
+        return nil, err
+    }
+    return fsys.Open(name)
+}
+
+// Stat returns the file info of a file of the pack.
+func (p *lazyPack) Stat(name string) (fs.FileInfo, error) {
+    fsys, err := p.store()
+    if err != nil {
+        return nil, err
+    }
+    return fs.Stat(fsys, name)
+}
+
+// ReadDir lists a directory of the pack.
+func (p *lazyPack) ReadDir(name string) ([]fs.DirEntry, error) {
+    fsys, err := p.store()
+    if err != nil {
+        return nil, err
+    }
+    return fs.ReadDir(fsys, name)
+}
+
+// openPack returns the contents of the help pack at file. A zip pack is
+// read in place through its central directory. A tar pack has none and
+// cannot be read from the middle once compressed, so it is read through
+// once and its files are kept.
+func openPack(file string) (fs.FS, error) {
+    if strings.HasSuffix(file, ".zip") {
+        return zip.OpenReader(file)
+    }
+    pack := &tarPack{file: file, entries: map[string]*tarEntry{".": {name: ".", dir: true}}}
+    var readErr error
+    err := pack.scan(func(name string, hdr *tar.Header, r io.Reader) bool {
+        var data []byte
+        if data, readErr = io.ReadAll(r); readErr != nil {
+            return false
+        }
+        pack.add(name, data, hdr.ModTime)
+        return true
+    })
+    if err == nil && readErr != nil {
+        err = &corruptPageError{file, readErr}
+    }
+    if err != nil {
+        return nil, err
+    }
+    for _, e := range pack.entries {
+        sort.Strings(e.children)
+    }
+    return pack, nil
+}
+
+// tarPack is the contents of a tar.gz help pack.
+type tarPack struct {
+    file    string
+    entries map[string]*tarEntry // files and directories by name
+}
+
+// tarEntry is a file or directory in a tar pack. It serves as both the
+// fs.FileInfo and the fs.DirEntry of it.
+type tarEntry struct {
+    name     string
+    data     []byte // what a file holds
+    modTime  time.Time
+    dir      bool
+    children []string // names of the entries in a directory
+}
+
+func (e *tarEntry) Name() string               { return path.Base(e.name) }
+func (e *tarEntry) Size() int64                { return int64(len(e.data)) }
+func (e *tarEntry) ModTime() time.Time         { return e.modTime }
+func (e *tarEntry) IsDir() bool                { return e.dir }
+func (e *tarEntry) Sys() interface{}           { return nil }
+func (e *tarEntry) Type() fs.FileMode          { return e.Mode().Type() }
+func (e *tarEntry) Info() (fs.FileInfo, error) { return e, nil }
+
+func (e *tarEntry) Mode() fs.FileMode {
+    if e.dir {
+        return fs.ModeDir | 0555
+    }
+    return 0444
+}
+
+// scan reads the regular files of the pack in order, calling f with the
+// name and header of each and a reader of its contents until f returns
+// false.
+func (p *tarPack) scan(f func(name string, hdr *tar.Header, r io.Reader) bool) error {
+    file, err := os.Open(p.file)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+    gz, err := gzip.NewReader(file)
+    if err != nil {
+        return &corruptPageError{p.file, err}
+    }
+    tr := tar.NewReader(gz)
+    for {
+        hdr, err := tr.Next()
+        if err == io.EOF {
+            return nil
+        }
+        if err != nil {
+            return &corruptPageError{p.file, err}
+        }
+        if hdr.Typeflag != tar.TypeReg {
+            continue
+        }
+        name := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+        if !f(name, hdr, tr) {
+            return nil
+        }
+    }
+}
+
+// add records a file and the directories above it.
+func (p *tarPack) add(name string, data []byte, modTime time.Time) {
+    if _, ok := p.entries[name]; ok || name == "" {
+        return
+    }
+    p.entries[name] = &tarEntry{name: name, data: data, modTime: modTime}
+    for child := name; child != "."; {
+        dir := path.Dir(child)
+        parent, ok := p.entries[dir]
+        if !ok {
+            parent = &tarEntry{name: dir, modTime: modTime, dir: true}
+            p.entries[dir] = parent
+        }
+        parent.children = append(parent.children, child)
+        if ok {
+            break
+        }
+        child = dir
+    }
+}
+
+// entry returns the entry of the named file or directory.
+func (p *tarPack) entry(op, name string) (*tarEntry, error) {
+    e, ok := p.entries[name]
+    if !ok || !fs.ValidPath(name) {
+        return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+    }
+    return e, nil
+}
+
+// Stat returns the file info of a file of the pack.
+func (p *tarPack) Stat(name string) (fs.FileInfo, error) {
+    return p.entry("stat", name)
+}
+
+// ReadDir lists a directory of the pack.
+func (p *tarPack) ReadDir(name string) ([]fs.DirEntry, error) {
+    e, err := p.entry("readdir", name)
+    if err != nil {
+        return nil, err
+    }
+    var entries []fs.DirEntry
+    for _, child := range e.children {
+        entries = append(entries, p.entries[child])
+    }
+    return entries, nil
+}
+
+// Open opens a file of the pack.
+func (p *tarPack) Open(name string) (fs.File, error) {
+    e, err := p.entry("open", name)
+    if err != nil {
+        return nil, err
+    }
+    if e.dir {
+        return &tarFile{entry: e}, nil
+    }
+    return &tarFile{entry: e, Reader: bytes.NewReader(e.data)}, nil
+}
+
+// tarFile is an open file or directory of a tar pack.
+type tarFile struct {
+    entry *tarEntry
+    *bytes.Reader
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) { return f.entry, nil }
+func (f *tarFile) Close() error               { return nil }
+
+func (f *tarFile) Read(b []byte) (int, error) {
+    if f.Reader == nil {
+        return 0, &fs.PathError{Op: "read", Path: f.entry.name, Err: fs.ErrInvalid}
+    }
+    return f.Reader.Read(b)
+}
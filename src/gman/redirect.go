@@ -0,0 +1,123 @@
+// Copyright 2014 The Gman Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in LICENSE file.
+
+package main
+
+import (
+    "bytes"   // for reading redirect stubs
+    "fmt"     // for reporting errors
+    "mandown" // for finding and parsing the title heading
+    "path"    // for redirect targets given as paths
+    "strings" // for string manipulation
+)
+
+// maxRedirects is the longest chain of redirect stubs that is followed.
+const maxRedirects = 8
+
+// maxStubSize is the size of the largest page file that may be a redirect
+// stub. Larger pages are not read to find out.
+const maxStubSize = 512
+
+// redirectTarget returns the page a redirect stub leads to. Like a man page
+// ".so" link, a stub holds a single line such as ".so gzip(1)",
+// ".so gzip.1" or ".so gman1/gzip.1.md".
+func redirectTarget(input []byte) (string, bool) {
+    line := string(bytes.TrimSpace(input))
+    if !strings.HasPrefix(line, ".so ") || strings.Contains(line, "\n") {
+        return "", false
+    }
+    return strings.TrimSpace(line[len(".so "):]), true
+}
+
+// redirectName returns the page name and section a redirect target names.
+// The section is empty when the target does not give one.
+func redirectName(target string) (string, string) {
+    file := path.Base(target)
+    file = strings.TrimSuffix(strings.TrimSuffix(file, compressionExt(file)), ".md")
+    if name, section, description, ok := mandown.ParseTitle(file); ok && description == "" {
+        return name, section
+    }
+    if i := strings.LastIndex(file, "."); i > 0 && isSection(file[i+1:]) {
+        return file[:i], file[i+1:]
+    }
+    return file, ""
+}
+
+// lookup is findPages followed by redirect stubs: each stub found is
+// replaced by the page it leads to.
+func (lib *library) lookup(name, section string, all bool) ([]pageRef, error) {
+    refs, err := lib.findPages(name, section, all)
+    if err != nil {
+        return nil, err
+    }
+    for i, ref := range refs {
+        if refs[i], err = lib.follow(ref); err != nil {
+            return nil, err
+        }
+    }
+    return refs, nil
+}
+
+// follow returns the page a chain of redirect stubs starting at ref leads
+// to, which records the name that was asked for, or ref itself if it is not
+// a stub. A page small enough to be a stub is read to find out, and keeps
+// what was read for the caller. A chain that loops or leads nowhere is an
+// error.
+func (lib *library) follow(ref pageRef) (pageRef, error) {
+    from := ref
+    chain := []string{ref.name + "(" + ref.section + ")"}
+    seen := map[string]bool{ref.path: true}
+    for {
+        if fi, err := lib.stat(ref.path); err == nil && fi.Size() > maxStubSize {
+            break
+        }
+        input, err := lib.readPage(ref)
+        if err != nil {
+            // Reading the page will fail again and say why.
+            break
+        }
+        target, ok := redirectTarget(input)
+        if !ok {
+            ref.input = input
+            break
+        }
+        name, section := redirectName(target)
+        next, err := lib.findPages(name, section, false)
+        if err != nil {
+            return ref, fmt.Errorf("gman: %s redirects to %s, which is not found", chain[len(chain)-1], target)
+        }
+        ref = next[0]
+        chain = append(chain, ref.name+"("+ref.section+")")
+        if seen[ref.path] || len(chain) > maxRedirects+1 {
+            return ref, fmt.Errorf("gman: redirect loop: %s", strings.Join(chain, " -> "))
+        }
+        seen[ref.path] = true
+    }
+    if ref.path != from.path {
+        ref.redirectedFrom = from.name
+        if from.redirectedFrom != "" {
+            ref.redirectedFrom = from.redirectedFrom
+        }
+    }
+    return ref, nil
+}
+
+// markRedirect adds "(redirected from name)" to the title heading of a
+// page, the first heading in it.
+func markRedirect(input []byte, from string) []byte {
+    note := "(redirected from " + from + ")"
+    doc := mandown.Parse(input)
+    headings := doc.Headings()
+    if len(headings) == 0 {
+        return append([]byte("*"+note+"*\n\n"), input...)
+    }
+    h := headings[0]
+    if h.End-h.Start == 2 {
+        // A Setext title underlined on the next line.
+        doc.Lines[h.Start] = h.Title + " " + note
+    } else {
+        doc.Lines[h.Start] = strings.Repeat("#", h.Level) + " " + h.Title + " " + note
+    }
+    return []byte(strings.Join(doc.Lines, "\n") + "\n")
+}
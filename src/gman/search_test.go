@@ -0,0 +1,128 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+    "testing"
+    "testing/fstest"
+)
+
+func TestSearch_Query(t *testing.T) {
+    tests := []struct {
+        args []string
+        want string // phrases and scope, or "" for an error
+    }{
+        {[]string{"print", "more"}, "[[print] [more]] "},
+        // Several words in one argument, or in quotes, are a phrase.
+        {[]string{"print more"}, "[[print more]] "},
+        {[]string{`"print`, `more"`, "output"}, "[[print more] [output]] "},
+        {[]string{`say "print more" now`}, "[[say] [print more] [now]] "},
+        // A section: argument limits the search to matching sections.
+        {[]string{"Section:Options", "--verbose"}, "[[--verbose]] options"},
+        // There must be something to search for.
+        {nil, ""},
+        {[]string{`""`}, ""},
+        {[]string{"section:options"}, ""},
+        {[]string{"!?"}, ""},
+    }
+    for _, tt := range tests {
+        q, err := parseQuery(tt.args)
+        if tt.want == "" {
+            if err == nil {
+                t.Errorf("parseQuery(%q) = %v, want nothing to search for", tt.args, q.phrases)
+            }
+            continue
+        }
+        if got := fmt.Sprint(q.phrases) + " " + q.scope; err != nil || got != tt.want {
+            t.Errorf("parseQuery(%q) = %q, %v, want %q", tt.args, got, err, tt.want)
+        }
+    }
+}
+
+func TestSearch_Index(t *testing.T) {
+    lib := testLibrary(fstest.MapFS{
+        "linux/en/gman1/tool.1.md": page("# tool(1) - does things\n\n## Options\n\n" +
+            "#### -v, --verbose\nPrint more output.\n\n## Description\nThe tool prints output in color.\n"),
+        "linux/en/gman1/other.1.md": page("# other(1)\n\n## Description\nMore output printed here.\n"),
+        "osx/en/gman1/mac.1.md":     page("# mac(1)\n\nOutput for another os.\n"),
+    })
+    idx := &pageIndex{Version: indexVersion}
+    idx.update(lib)
+
+    tests := []struct {
+        args string
+        want []string // page and heading of each hit, best first
+    }{
+        {"output", []string{"other Description", "tool Description", "tool -v, --verbose"}},
+        // Words of a phrase must follow one another.
+        {`"print more"`, []string{"tool -v, --verbose"}},
+        // Every phrase must occur in the section.
+        {"color output", []string{"tool Description"}},
+        // A match in the heading counts double.
+        {"description", []string{"other Description", "tool Description"}},
+        {"section:options output", []string{"tool -v, --verbose"}},
+        {"section:files output", nil},
+        {"nowhere", nil},
+    }
+    for _, tt := range tests {
+        q, err := parseQuery(strings.Fields(tt.args))
+        if err != nil {
+            t.Fatal(err)
+        }
+        var got []string
+        for _, h := range idx.search(q, idx.selected(lib.v)) {
+            got = append(got, h.entry.Name+" "+h.section.Path[len(h.section.Path)-1])
+        }
+        if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+            t.Errorf("search(%s) = %q, want %q", tt.args, got, tt.want)
+        }
+    }
+}
+
+func TestSearch_EditDistance(t *testing.T) {
+    tests := []struct {
+        a, b string
+        want int
+    }{
+        {"", "", 0},
+        {"gzip", "gzip", 0},
+        {"abc", "", 3},
+        {"", "abc", 3},
+        {"gman", "gmna", 2},
+        {"kitten", "sitting", 3},
+        // Distances count runes, not bytes.
+        {"日本", "日", 1},
+    }
+    for _, tt := range tests {
+        if got := editDistance(tt.a, tt.b); got != tt.want {
+            t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+        }
+    }
+}
+
+func TestSearch_Suggest(t *testing.T) {
+    tests := []struct {
+        name  string
+        names string
+        want  string
+    }{
+        // Close names first, by distance and then name; the name itself
+        // and repeats are left out.
+        {"gzp", "tar zip gzip grep gzp gzip", "gzip grep zip"},
+        // Short names allow one edit; names sharing a prefix come after.
+        {"ls", "cp ln lsblk", "ln lsblk"},
+        // A single letter is too short to be a prefix.
+        {"l", "lsblk ls", "ls"},
+        // Long names allow no more than three edits.
+        {"abcdefghijkl", "abcdefghixxx abcdefgxxxxx", "abcdefghixxx"},
+        // No more than maxSuggestions are given.
+        {"a", "b c d e f g h", "b c d e f"},
+        {"gman", "", ""},
+    }
+    for _, tt := range tests {
+        got := strings.Join(suggest(tt.name, strings.Fields(tt.names)), " ")
+        if got != tt.want {
+            t.Errorf("suggest(%q, %q) = %q, want %q", tt.name, tt.names, got, tt.want)
+        }
+    }
+}
@@ -0,0 +1,141 @@
+// Copyright 2014 The Gman Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in LICENSE file.
+
+package main
+
+import (
+    "errors"  // for reporting errors
+    "mandown" // for finding headings
+    "regexp"  // for regex selectors
+    "strings" // for string manipulation
+)
+
+// sectionSelector picks document sections by heading. A plain selector such
+// as "Options/-b" is a slash separated heading path: the last element must
+// match the heading and the ones before it must match, in order, headings
+// that enclose it. Use "\/" for a slash within a heading.
+type sectionSelector struct {
+    source string         // the selector as given, for messages
+    path   []string       // heading path elements, or nil for a regex
+    re     *regexp.Regexp // heading regex, or nil for a path
+    exact  bool           // elements must equal the whole heading
+    fold   bool           // ignore case
+}
+
+// sectionSelectors returns the selectors given by the --section (-s) and
+// --section-regex options, matched as --exact and --ignore-case say.
+func sectionSelectors(opts map[string]interface{}) ([]sectionSelector, error) {
+    exact, _ := opts["--exact"].(bool)
+    fold, _ := opts["--ignore-case"].(bool)
+    var selectors []sectionSelector
+    if paths, ok := opts["--section"].([]string); ok {
+        for _, p := range paths {
+            selectors = append(selectors, newPathSelector(p, exact, fold))
+        }
+    }
+    if exprs, ok := opts["--section-regex"].([]string); ok {
+        for _, e := range exprs {
+            s, err := newRegexSelector(e, fold)
+            if err != nil {
+                return nil, err
+            }
+            selectors = append(selectors, s)
+        }
+    }
+    return selectors, nil
+}
+
+// newPathSelector returns a selector for a heading path.
+func newPathSelector(source string, exact, fold bool) sectionSelector {
+    var path []string
+    for _, elem := range strings.Split(strings.Replace(source, `\/`, "\x00", -1), "/") {
+        path = append(path, strings.TrimSpace(strings.Replace(elem, "\x00", "/", -1)))
+    }
+    return sectionSelector{source: source, path: path, exact: exact, fold: fold}
+}
+
+// newRegexSelector returns a selector for headings matching expr.
+func newRegexSelector(expr string, fold bool) (sectionSelector, error) {
+    source := expr
+    if fold {
+        expr = "(?i)" + expr
+    }
+    re, err := regexp.Compile(expr)
+    if err != nil {
+        return sectionSelector{}, errors.New("gman: bad section regex: " + err.Error())
+    }
+    return sectionSelector{source: source, re: re, fold: fold}, nil
+}
+
+// matchElem reports whether a single path element matches title.
+func (s sectionSelector) matchElem(elem, title string) bool {
+    switch {
+    case s.exact && s.fold:
+        return strings.EqualFold(elem, title)
+    case s.exact:
+        return elem == title
+    case s.fold:
+        return strings.Contains(strings.ToLower(title), strings.ToLower(elem))
+    }
+    return strings.Contains(title, elem)
+}
+
+// match reports whether the selector picks heading h, given the headings
+// that enclose it, outermost first.
+func (s sectionSelector) match(h mandown.Block, parents []mandown.Block) bool {
+    if s.re != nil {
+        return s.re.MatchString(h.Title)
+    }
+    last := len(s.path) - 1
+    if !s.matchElem(s.path[last], h.Title) {
+        return false
+    }
+    i := 0
+    for _, p := range parents {
+        if i < last && s.matchElem(s.path[i], p.Title) {
+            i++
+        }
+    }
+    return i == last
+}
+
+// extractDocSections returns, in document order, every section picked by
+// one of the selectors, with the sections nested below it. Headings are found
+// with the same block rules the renderer uses, so "#" lines inside code
+// blocks are left alone and underlined (Setext) headings are recognized. The
+// selectors that matched nothing are returned as well.
+func extractDocSections(input []byte, selectors []sectionSelector) ([]byte, []string, error) {
+    doc := mandown.Parse(input)
+    var sections []string
+    var parents []mandown.Block
+    var end = 0
+    matched := make([]bool, len(selectors))
+    for _, h := range doc.Headings() {
+        for len(parents) > 0 && parents[len(parents)-1].Level >= h.Level {
+            parents = parents[:len(parents)-1]
+        }
+        for i, s := range selectors {
+            if !s.match(h, parents) {
+                continue
+            }
+            matched[i] = true
+            if h.Start >= end {
+                end = doc.SectionEnd(h)
+                sections = append(sections, doc.Source(h.Start, end))
+            }
+        }
+        parents = append(parents, h)
+    }
+
+    var missing []string
+    for i, s := range selectors {
+        if !matched[i] {
+            missing = append(missing, s.source)
+        }
+    }
+    if len(sections) == 0 {
+        return nil, missing, errors.New("gman: document section not found")
+    }
+    return []byte(strings.Join(sections, "\n")), missing, nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2014 The Gman Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in LICENSE file.
+
+package main
+
+import (
+    "embed"         // for the built-in pages
+    "io/fs"         // for reading page roots
+    "os"            // for local file access
+    "path/filepath" // for building page paths
+    "strings"       // for string manipulation
+)
+
+// builtinPages holds gman's own pages, compiled into the binary so that
+// "gman gman" works wherever gman is installed.
+//
+//go:embed help
+var builtinPages embed.FS
+
+// builtinRoot is the name of the root holding the built-in pages. It is
+// always searched last.
+const builtinRoot = "builtin:"
+
+// openStore returns the file system holding the pages of root: the
+// built-in pages, a help pack or a directory.
+func openStore(root string) (fs.FS, error) {
+    switch {
+    case root == builtinRoot:
+        return fs.Sub(builtinPages, "help")
+    case isPack(root):
+        return &lazyPack{file: root}, nil
+    default:
+        return os.DirFS(root), nil
+    }
+}
+
+// locate returns the store holding path and the name of path within it.
+// It returns false for paths outside every root.
+func (lib *library) locate(p string) (fs.FS, string, bool) {
+    var root string
+    for r := range lib.stores {
+        if len(r) > len(root) && strings.HasPrefix(p, r+string(filepath.Separator)) {
+            root = r
+        }
+    }
+    if root == "" {
+        return nil, "", false
+    }
+    return lib.stores[root], filepath.ToSlash(p[len(root)+1:]), true
+}
+
+// stat returns the file info of path.
+func (lib *library) stat(p string) (fs.FileInfo, error) {
+    store, name, ok := lib.locate(p)
+    if !ok {
+        return nil, &fs.PathError{Op: "stat", Path: p, Err: fs.ErrNotExist}
+    }
+    return fs.Stat(store, name)
+}
+
+// open opens path for reading.
+func (lib *library) open(p string) (fs.File, error) {
+    store, name, ok := lib.locate(p)
+    if !ok {
+        return nil, &fs.PathError{Op: "open", Path: p, Err: fs.ErrNotExist}
+    }
+    return store.Open(name)
+}
+
+// isFile reports whether path is an existing regular file.
+func (lib *library) isFile(p string) bool {
+    fi, err := lib.stat(p)
+    return err == nil && !fi.IsDir()
+}
+
+// glob returns the paths under root matching pattern, whose elements are
+// separated by slashes.
+func (lib *library) glob(root, pattern string) []string {
+    store, ok := lib.stores[root]
+    if !ok {
+        return nil
+    }
+    names, _ := fs.Glob(store, pattern)
+    var matches []string
+    for _, name := range names {
+        matches = append(matches, filepath.Join(root, filepath.FromSlash(name)))
+    }
+    return matches
+}
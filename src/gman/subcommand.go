@@ -0,0 +1,90 @@
+// Copyright 2014 The Gman Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in LICENSE file.
+
+package main
+
+import (
+    "log"     // for debug logging
+    "mandown" // for finding subcommand sections
+    "os"      // for not found errors
+    "strings" // for string manipulation
+)
+
+// commandWords returns how many of the leading words of a page argument
+// such as "git remote add -v" name a command and its subcommands: those
+// before the first option.
+func commandWords(words []string) int {
+    n := 1
+    for n < len(words) && !strings.HasPrefix(words[n], "-") {
+        n++
+    }
+    return n
+}
+
+// subcommandPages returns the page names a command with subcommands may be
+// documented under, most specific first: "git-remote-add", then
+// "git-remote" for "git remote add".
+func subcommandPages(words []string) []string {
+    var names []string
+    for k := commandWords(words); k >= 2; k-- {
+        names = append(names, strings.Join(words[:k], "-"))
+    }
+    return names
+}
+
+// lookupCommand finds the page for a page argument split into words. For a
+// command with subcommands, as in "gman git commit", a page for the
+// subcommand such as git-commit is preferred. Otherwise the command's page
+// is returned. Subcommands the page found is not named after are returned
+// to be looked for as sections of it, and the remaining words are options
+// to extract.
+func (lib *library) lookupCommand(words []string, section string, all bool) (refs []pageRef, subs, args []string, err error) {
+    n := commandWords(words)
+    for i, name := range subcommandPages(words) {
+        log.Println("Trying subcommand page", name)
+        refs, err = lib.lookup(name, section, all)
+        if err == nil {
+            return refs, words[n-i : n], words[n:], nil
+        }
+        if err != os.ErrNotExist {
+            return nil, nil, nil, err
+        }
+    }
+    log.Println("Trying page", words[0])
+    refs, err = lib.lookup(words[0], section, all)
+    return refs, words[1:n], words[n:], err
+}
+
+// subcommandSection returns the part of a page documenting the subcommand
+// path subs, such as ["remote", "add"]: the section under a heading for the
+// first subcommand, narrowed to the heading for the next within it, and so
+// on. It returns false if a heading is missing.
+func subcommandSection(input []byte, command string, subs []string) ([]byte, bool) {
+    doc := mandown.Parse(input)
+    start, end := 0, len(doc.Lines)
+    for _, sub := range subs {
+        found := false
+        for _, h := range doc.Headings() {
+            if h.Start >= start && h.Start < end && subcommandHeading(h.Title, command, sub) {
+                start, end = h.Start, doc.SectionEnd(h)
+                found = true
+                break
+            }
+        }
+        if !found {
+            return nil, false
+        }
+    }
+    return []byte(doc.Source(start, end)), true
+}
+
+// subcommandHeading reports whether a heading documents the subcommand sub
+// of command: its first word is sub, or it starts with "command sub", as
+// in "commit [options]" or "git commit".
+func subcommandHeading(title, command, sub string) bool {
+    words := strings.Fields(strings.ToLower(cleanText(title)))
+    sub = strings.ToLower(sub)
+    return len(words) > 0 && words[0] == sub ||
+        len(words) > 1 && words[0] == strings.ToLower(command) && words[1] == sub
+}
@@ -0,0 +1,119 @@
+// Copyright 2014 The Gman Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in LICENSE file.
+
+package main
+
+import (
+    "fmt"     // for printing hints
+    "io"      // for writing hints
+    "sort"    // for ordering suggestions
+    "strings" // for string manipulation
+)
+
+// maxSuggestions is how many "did you mean" suggestions are printed.
+const maxSuggestions = 5
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+    s, t := []rune(a), []rune(b)
+    prev := make([]int, len(t)+1)
+    cur := make([]int, len(t)+1)
+    for j := range prev {
+        prev[j] = j
+    }
+    for i := 1; i <= len(s); i++ {
+        cur[0] = i
+        for j := 1; j <= len(t); j++ {
+            cost := 1
+            if s[i-1] == t[j-1] {
+                cost = 0
+            }
+            cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+        }
+        prev, cur = cur, prev
+    }
+    return prev[len(t)]
+}
+
+// suggest returns up to maxSuggestions page names close to name: those
+// within a small edit distance and those sharing a prefix with it, closest
+// first.
+func suggest(name string, names []string) []string {
+    limit := len([]rune(name))/3 + 1
+    if limit > 3 {
+        limit = 3
+    }
+    type candidate struct {
+        name string
+        dist int
+    }
+    var candidates []candidate
+    seen := make(map[string]bool)
+    for _, n := range names {
+        if n == name || seen[n] {
+            continue
+        }
+        seen[n] = true
+        d := editDistance(strings.ToLower(name), strings.ToLower(n))
+        prefix := len(name) >= 2 && (strings.HasPrefix(n, name) || strings.HasPrefix(name, n))
+        if d <= limit || prefix {
+            if prefix && d > limit {
+                // Rank prefix matches after close misspellings.
+                d = limit + 1
+            }
+            candidates = append(candidates, candidate{n, d})
+        }
+    }
+    sort.Slice(candidates, func(i, j int) bool {
+        if candidates[i].dist != candidates[j].dist {
+            return candidates[i].dist < candidates[j].dist
+        }
+        return candidates[i].name < candidates[j].name
+    })
+
+    var result []string
+    for i := 0; i < len(candidates) && i < maxSuggestions; i++ {
+        result = append(result, candidates[i].name)
+    }
+    return result
+}
+
+// pageNames returns the name of every page in the index, for every os and
+// lang.
+func (idx *pageIndex) pageNames() []string {
+    var names []string
+    for _, e := range idx.Entries {
+        names = append(names, e.Name)
+    }
+    return names
+}
+
+// explainMissing writes hints about a page that was not found: the other
+// sections or os and lang variants it does exist in, a system man page of
+// that name and pages with similar names.
+func (lib *library) explainMissing(w io.Writer, idx *pageIndex, name, section string) {
+    var sections, variants []string
+    for _, e := range idx.Entries {
+        switch {
+        case e.Name != name:
+        case contains(lib.v.oses, e.OS) && contains(lib.v.langs, e.Lang):
+            sections = appendUnique(sections, e.Section)
+        default:
+            variants = appendUnique(variants, e.OS+"/"+e.Lang)
+        }
+    }
+    if len(sections) > 0 {
+        fmt.Fprintf(w, "gman: %s is in section %s\n", name, strings.Join(sections, ", "))
+    }
+    if len(variants) > 0 {
+        fmt.Fprintf(w, "gman: %s exists for %s; set the os or lang config key to read it\n",
+            name, strings.Join(variants, ", "))
+    }
+    if _, ok := findManPage(name, section, lib.order); ok {
+        fmt.Fprintf(w, "gman: there is a system man page for %s; try 'gman -q man %s'\n", name, name)
+    }
+    if names := suggest(name, idx.pageNames()); len(names) > 0 {
+        fmt.Fprintf(w, "gman: did you mean %s?\n", strings.Join(names, ", "))
+    }
+}
@@ -0,0 +1,38 @@
+// Copyright 2014 The Gman Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in LICENSE file.
+
+package main
+
+import (
+    "fmt"     // for reading the width option
+    "os"      // for reading the environment
+    "strconv" // for reading COLUMNS
+)
+
+// defaultWidth is the width pages are filled to when it cannot be found
+// out.
+const defaultWidth = 80
+
+// outputWidth returns the number of columns pages are filled to: the
+// --width option, else the width of the terminal, else the COLUMNS
+// environment variable, else the "width" config key, else defaultWidth.
+func outputWidth(opts map[string]interface{}) (int, error) {
+    if s, ok := opts["--width"].(string); ok {
+        n, err := strconv.Atoi(s)
+        if err != nil || n <= 0 {
+            return 0, fmt.Errorf("gman: bad width %s; want a number of columns", s)
+        }
+        return n, nil
+    }
+    if n := terminalWidth(os.Stdout); n > 0 {
+        return n, nil
+    }
+    if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+        return n, nil
+    }
+    if n, ok := opts["width"].(float64); ok && n > 0 {
+        return int(n), nil
+    }
+    return defaultWidth, nil
+}
@@ -0,0 +1,431 @@
+// Copyright 2014 The Gman Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in LICENSE file.
+
+package main
+
+import (
+    "fmt"          // for numbering list items
+    "highlight"    // for highlighting code
+    "io"           // for writing output
+    "mandown"      // for the page tree
+    "strings"      // for string manipulation
+    "unicode"      // for splitting words and measuring text
+    "unicode/utf8" // for measuring text
+)
+
+// textIndent is how far the text of a section is indented below its
+// heading.
+const textIndent = 4
+
+// minTextWidth is the narrowest column text is wrapped to, however deeply
+// it is indented.
+const minTextWidth = 20
+
+// element is a kind of text that terminal output may style.
+type element int
+
+const (
+    plainElement element = iota
+    h1Element            // title heading
+    h2Element            // section heading
+    h3Element            // subsection heading
+    h4Element            // definition entry and deeper headings
+    strongElement
+    emphasisElement
+    codeElement
+    optionElement // option names in the heading of an option entry
+    linkElement
+    quoteElement
+    commentElement // kinds of highlighted code, named as in package highlight
+    keywordElement
+    stringElement
+    numberElement
+    variableElement
+    commandElement
+    operatorElement
+    keyElement
+    builtinElement
+    insertedElement
+    deletedElement
+    metaElement
+)
+
+// headingElement returns the element of the heading of sec. The heading of
+// a definition entry that starts with a dash names options.
+func headingElement(sec *mandown.Node) element {
+    switch {
+    case sec.Level >= 4 && strings.HasPrefix(sec.Title, "-"):
+        return optionElement
+    case sec.Level >= 4:
+        return h4Element
+    }
+    return h1Element + element(sec.Level-1)
+}
+
+// textLayout lays out pages as lines of text like a man page: headings at
+// the left margin, the text under each indented below it, and definition
+// entries such as options indented again under their section. Paragraphs,
+// list items and quotes are filled to the width, with list items hanging
+// under their markers; code and tables are left as they are.
+type textLayout struct {
+    width int                                 // columns to fill; 0 keeps the source lines
+    style func(e element, text string) string // styles a word; nil for plain text
+    lang  string                              // language of code blocks that name none
+}
+
+// write writes pages, separated by a rule.
+func (l *textLayout) write(w io.Writer, pages []outputPage) error {
+    for i, p := range pages {
+        if i > 0 {
+            io.WriteString(w, "\n* * *\n\n")
+        }
+        lines := l.section(mandown.Parse(p.body).Tree(), l.width)
+        if _, err := io.WriteString(w, strings.Join(lines, "\n")+"\n"); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// section returns the lines of a section. The sections of the title
+// heading, like those of the page itself, are not indented under it.
+func (l *textLayout) section(sec *mandown.Node, width int) []string {
+    if lang := sectionLanguage(sec.Title, l.lang); lang != l.lang {
+        inner := *l
+        inner.lang = lang
+        l = &inner
+    }
+    var lines []string
+    if sec.Level > 0 {
+        lines = append(lines, strings.Join(l.words(sec.Title, headingElement(sec)), " "))
+    }
+    for _, n := range sec.Children {
+        var more []string
+        switch {
+        case n.Kind == mandown.SectionNode && sec.Level <= 1:
+            more = l.section(n, width)
+        case n.Kind == mandown.SectionNode:
+            more = indentLines(l.section(n, narrower(width, textIndent)), textIndent)
+        case sec.Level == 0:
+            more = l.node(n, width)
+        default:
+            more = indentLines(l.node(n, narrower(width, textIndent)), textIndent)
+        }
+        lines = joinBlocks(lines, more)
+    }
+    return lines
+}
+
+// blocks returns the lines of a run of nodes, with a blank line between
+// blocks.
+func (l *textLayout) blocks(nodes []*mandown.Node, width int) []string {
+    var lines []string
+    for _, n := range nodes {
+        lines = joinBlocks(lines, l.node(n, width))
+    }
+    return lines
+}
+
+// node returns the lines of a node, not indented.
+func (l *textLayout) node(n *mandown.Node, width int) []string {
+    switch n.Kind {
+    case mandown.SectionNode:
+        return l.section(n, width)
+    case mandown.ParagraphNode:
+        return l.paragraph(n.Text, width)
+    case mandown.CodeNode:
+        return indentLines(l.code(n), textIndent)
+    case mandown.ListNode:
+        var lines []string
+        for i, item := range n.Children {
+            marker := "- "
+            if n.Ordered {
+                marker = fmt.Sprintf("%d. ", i+1)
+            }
+            body := l.blocks(item.Children, narrower(width, len(marker)))
+            if len(body) == 0 {
+                body = []string{""}
+            }
+            body = indentLines(body, len(marker))
+            body[0] = marker + strings.TrimLeft(body[0], " ")
+            lines = append(lines, body...)
+        }
+        return lines
+    case mandown.QuoteNode:
+        quoted := *l
+        if l.style != nil {
+            quoted.style = func(e element, text string) string {
+                if e == plainElement {
+                    e = quoteElement
+                }
+                return l.style(e, text)
+            }
+        }
+        return indentLines(quoted.blocks(n.Children, narrower(width, textIndent)), textIndent)
+    case mandown.TableNode:
+        return l.table(n.Rows)
+    case mandown.RuleNode:
+        return []string{"* * *"}
+    }
+    return nil
+}
+
+// code returns the lines of a code block, highlighted if output is styled
+// and there is a lexer for its language. Each token is styled as the
+// element of the same name; text, which has none, is plain.
+func (l *textLayout) code(n *mandown.Node) []string {
+    var tokens []highlight.Token
+    if l.style != nil {
+        tokens = highlight.Tokens(codeLanguage(n.Info, l.lang), n.Text)
+    }
+    if tokens == nil {
+        return strings.Split(n.Text, "\n")
+    }
+    var lines []string
+    var line strings.Builder
+    for _, t := range tokens {
+        for i, part := range strings.Split(t.Text, "\n") {
+            if i > 0 {
+                lines = append(lines, line.String())
+                line.Reset()
+            }
+            if part != "" {
+                line.WriteString(l.style(elementNames[t.Kind.String()], part))
+            }
+        }
+    }
+    return append(lines, line.String())
+}
+
+// paragraph returns the lines of a paragraph, filled to width or, without
+// a width, broken where the source lines are.
+func (l *textLayout) paragraph(text string, width int) []string {
+    if width > 0 {
+        return wrap(l.words(text, plainElement), width)
+    }
+    var lines []string
+    for _, line := range strings.Split(text, "\n") {
+        if words := l.words(line, plainElement); len(words) > 0 {
+            lines = append(lines, strings.Join(words, " "))
+        }
+    }
+    return lines
+}
+
+// table returns the lines of a table, its columns aligned and its header
+// underlined.
+func (l *textLayout) table(rows [][]string) []string {
+    var cells [][]string
+    var widths []int
+    for _, row := range rows {
+        var texts []string
+        for i, cell := range row {
+            text := strings.Join(l.words(cell, plainElement), " ")
+            texts = append(texts, text)
+            if i == len(widths) {
+                widths = append(widths, 0)
+            }
+            if n := textWidth(text); n > widths[i] {
+                widths[i] = n
+            }
+        }
+        cells = append(cells, texts)
+    }
+    var lines []string
+    for r, row := range cells {
+        var line string
+        for i, text := range row {
+            line += text + strings.Repeat(" ", widths[i]-textWidth(text)+2)
+        }
+        lines = append(lines, strings.TrimRight(line, " "))
+        if r == 0 {
+            var rule []string
+            for _, n := range widths {
+                rule = append(rule, strings.Repeat("-", n))
+            }
+            lines = append(lines, strings.Join(rule, "  "))
+        }
+    }
+    return lines
+}
+
+// words returns the words of inline Markdown without its markup, each
+// styled as the text it is part of, or as e if it is plain text. Strong
+// emphasis is styled as both. HTML tags
+// are dropped and a link keeps its target, in angle brackets after the
+// text, unless the text is the target.
+func (l *textLayout) words(text string, e element) []string {
+    var words []string
+    var word strings.Builder
+    flush := func() {
+        if word.Len() > 0 {
+            words = append(words, word.String())
+            word.Reset()
+        }
+    }
+    add := func(text string, es ...element) {
+        start := -1
+        part := func(end int) {
+            if start >= 0 {
+                styled := text[start:end]
+                for _, e := range es {
+                    if l.style != nil {
+                        styled = l.style(e, styled)
+                    }
+                }
+                word.WriteString(styled)
+                start = -1
+            }
+        }
+        for i, r := range text {
+            if unicode.IsSpace(r) {
+                part(i)
+                flush()
+            } else if start < 0 {
+                start = i
+            }
+        }
+        part(len(text))
+    }
+    for _, s := range mandown.Inline(text) {
+        switch s.Kind {
+        case mandown.HTML:
+        case mandown.Strong:
+            add(s.Text, strongElement)
+        case mandown.Emphasis:
+            add(s.Text, emphasisElement)
+        case mandown.StrongEmphasis:
+            add(s.Text, emphasisElement, strongElement)
+        case mandown.CodeSpan:
+            add(s.Text, codeElement)
+        case mandown.Link:
+            add(s.Text, e)
+            if s.URL != s.Text {
+                add(" <", e)
+                add(s.URL, linkElement)
+                add(">", e)
+            }
+        default:
+            add(s.Text, e)
+        }
+    }
+    flush()
+    return words
+}
+
+// wrap fills lines with words up to width columns. A word wider than the
+// width is given a line of its own.
+func wrap(words []string, width int) []string {
+    var lines []string
+    var line string
+    for _, word := range words {
+        switch {
+        case line == "":
+            line = word
+        case textWidth(line)+1+textWidth(word) <= width:
+            line += " " + word
+        default:
+            lines = append(lines, line)
+            line = word
+        }
+    }
+    if line != "" {
+        lines = append(lines, line)
+    }
+    return lines
+}
+
+// narrower returns width less n columns, but no less than minTextWidth. A
+// width of 0, meaning no wrapping, stays 0.
+func narrower(width, n int) int {
+    if width == 0 {
+        return 0
+    }
+    if width -= n; width < minTextWidth {
+        return minTextWidth
+    }
+    return width
+}
+
+// textWidth returns the number of columns text takes on the terminal,
+// leaving out escape sequences.
+func textWidth(text string) int {
+    n := 0
+    for i := 0; i < len(text); {
+        if text[i] == '\x1b' {
+            if end := strings.IndexByte(text[i:], 'm'); end >= 0 {
+                i += end + 1
+                continue
+            }
+        }
+        r, size := utf8.DecodeRuneInString(text[i:])
+        i += size
+        n += runeWidth(r)
+    }
+    return n
+}
+
+// wideRunes are the runes terminals give two columns: the wide and
+// fullwidth East Asian characters and the common emoji blocks.
+var wideRunes = &unicode.RangeTable{
+    R16: []unicode.Range16{
+        {0x1100, 0x115f, 1},
+        {0x2e80, 0x303e, 1},
+        {0x3041, 0x33ff, 1},
+        {0x3400, 0x4dbf, 1},
+        {0x4e00, 0x9fff, 1},
+        {0xa000, 0xa4cf, 1},
+        {0xa960, 0xa97f, 1},
+        {0xac00, 0xd7a3, 1},
+        {0xf900, 0xfaff, 1},
+        {0xfe10, 0xfe19, 1},
+        {0xfe30, 0xfe6f, 1},
+        {0xff00, 0xff60, 1},
+        {0xffe0, 0xffe6, 1},
+    },
+    R32: []unicode.Range32{
+        {0x1f300, 0x1f64f, 1},
+        {0x1f900, 0x1f9ff, 1},
+        {0x20000, 0x2fffd, 1},
+        {0x30000, 0x3fffd, 1},
+    },
+}
+
+// runeWidth returns the number of columns r takes on the terminal: none
+// for combining marks and format characters, two for wide runes and one
+// for the rest.
+func runeWidth(r rune) int {
+    switch {
+    case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+        return 0
+    case unicode.Is(wideRunes, r):
+        return 2
+    }
+    return 1
+}
+
+// joinBlocks appends the lines of a block to lines, after a blank line if
+// lines is not empty.
+func joinBlocks(lines, block []string) []string {
+    if len(block) == 0 {
+        return lines
+    }
+    if len(lines) > 0 {
+        lines = append(lines, "")
+    }
+    return append(lines, block...)
+}
+
+// indentLines indents lines that are not blank by n spaces.
+func indentLines(lines []string, n int) []string {
+    prefix := strings.Repeat(" ", n)
+    var result []string
+    for _, line := range lines {
+        if strings.TrimSpace(line) != "" {
+            line = prefix + line
+        }
+        result = append(result, line)
+    }
+    return result
+}
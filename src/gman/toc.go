@@ -0,0 +1,91 @@
+// Copyright 2014 The Gman Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in LICENSE file.
+
+package main
+
+import (
+    "bytes"         // for counting front matter lines
+    "encoding/json" // for the --json table of contents
+    "fmt"           // for printing the table of contents
+    "io"            // for writing output
+    "mandown"       // for finding headings
+    "strings"       // for string manipulation
+    "unicode/utf8"  // for aligning anchors
+)
+
+// tocEntry is a heading in the JSON table of contents.
+type tocEntry struct {
+    Title    string     `json:"title"`
+    Level    int        `json:"level"`
+    Slug     string     `json:"slug"`
+    Line     int        `json:"line"`
+    Children []tocEntry `json:"children,omitempty"`
+}
+
+// tocEntries converts an outline to JSON table of contents entries. The
+// lines of the outline follow skip lines of front matter.
+func tocEntries(outline []*mandown.Section, skip int) []tocEntry {
+    var entries []tocEntry
+    for _, sec := range outline {
+        entries = append(entries, tocEntry{
+            Title:    sec.Heading.Title,
+            Level:    sec.Heading.Level,
+            Slug:     sec.Slug,
+            Line:     skip + sec.Heading.Start + 1,
+            Children: tocEntries(sec.Children, skip),
+        })
+    }
+    return entries
+}
+
+// writeTOCJSON writes the heading tree of the body of a page as JSON. The
+// line of each heading is its line in the page file, for editors to jump
+// to, so it counts the front matter above the body.
+func writeTOCJSON(w io.Writer, ref pageRef, input, body []byte) error {
+    skip := bytes.Count(input, []byte("\n")) - bytes.Count(body, []byte("\n"))
+    toc := struct {
+        Name     string     `json:"name"`
+        Section  string     `json:"section"`
+        Path     string     `json:"path"`
+        Headings []tocEntry `json:"headings"`
+    }{ref.name, ref.section, ref.path, tocEntries(mandown.Parse(body).Outline(), skip)}
+    if toc.Headings == nil {
+        toc.Headings = []tocEntry{}
+    }
+    out, err := json.MarshalIndent(toc, "", "  ")
+    if err != nil {
+        return err
+    }
+    _, err = fmt.Fprintf(w, "%s\n", out)
+    return err
+}
+
+// writeTOC writes the heading tree of input, indented by depth, with the
+// anchor of each heading aligned in a column to the right.
+func writeTOC(w io.Writer, input []byte) {
+    type line struct {
+        text, slug string
+    }
+    var lines []line
+    var walk func([]*mandown.Section, int)
+    walk = func(outline []*mandown.Section, depth int) {
+        for _, sec := range outline {
+            text := strings.Repeat("  ", depth) + sec.Heading.Title
+            lines = append(lines, line{text, sec.Slug})
+            walk(sec.Children, depth+1)
+        }
+    }
+    walk(mandown.Parse(input).Outline(), 0)
+
+    width := 0
+    for _, l := range lines {
+        if n := utf8.RuneCountInString(l.text); n > width {
+            width = n
+        }
+    }
+    for _, l := range lines {
+        pad := width - utf8.RuneCountInString(l.text) + 2
+        fmt.Fprintf(w, "%s%s#%s\n", l.text, strings.Repeat(" ", pad), l.slug)
+    }
+}
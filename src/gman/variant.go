@@ -0,0 +1,175 @@
+// Copyright 2014 The Gman Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in LICENSE file.
+
+package main
+
+import (
+    "fmt"     // for formatting notices
+    "os"      // for reading the locale environment
+    "runtime" // for detecting the operating system
+    "strings" // for string manipulation
+)
+
+// goosNames maps runtime.GOOS values to gman os directory names.
+var goosNames = map[string]string{
+    "darwin":  "osx",
+    "solaris": "sunos",
+    "illumos": "sunos",
+    "windows": "win",
+}
+
+// defaultOSFallback is tried, in order, after the page's own os.
+var defaultOSFallback = []string{"generic", "linux"}
+
+// variants is the ordered list of os and lang directories to search.
+type variants struct {
+    oses  []string
+    langs []string
+}
+
+// detectOS returns the gman os name for the running system.
+func detectOS() string {
+    if name, ok := goosNames[runtime.GOOS]; ok {
+        return name
+    }
+    return runtime.GOOS
+}
+
+// detectLang returns the message locale from the environment, following the
+// POSIX precedence of LC_ALL, LC_MESSAGES and then LANG.
+func detectLang() string {
+    for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+        if v := os.Getenv(name); v != "" {
+            return v
+        }
+    }
+    return ""
+}
+
+// langChain returns the languages to search for a locale, most specific
+// first, always ending with "en". For example "pt_BR.UTF-8" gives pt_BR, pt
+// and en.
+func langChain(locale string) []string {
+    // Drop the codeset and modifier: ll_TT.codeset@modifier
+    if i := strings.IndexAny(locale, ".@"); i >= 0 {
+        locale = locale[:i]
+    }
+    var chain []string
+    if locale != "" && locale != "C" && locale != "POSIX" {
+        parts := strings.SplitN(strings.Replace(locale, "-", "_", 1), "_", 2)
+        lang := strings.ToLower(parts[0])
+        if len(parts) == 2 && parts[1] != "" {
+            chain = append(chain, lang+"_"+strings.ToUpper(parts[1]))
+        }
+        chain = append(chain, lang)
+    }
+    return appendUnique(chain, "en")
+}
+
+// osChain returns the os directories to search, starting with name.
+func osChain(name string, fallback []string) []string {
+    return appendUnique([]string{name}, fallback...)
+}
+
+// pageOS returns the os a page in the os directory dir is for: that os, or
+// the one asked for if dir is "generic", which every os shares.
+func (v variants) pageOS(dir string) string {
+    if dir == "generic" && len(v.oses) > 0 {
+        return v.oses[0]
+    }
+    return dir
+}
+
+// forOS reports whether a page whose front matter lists oses is for the os
+// named osname. A page that lists none is for every os. Go's names, such as
+// darwin, may be used for gman's.
+func forOS(oses []string, osname string) bool {
+    if len(oses) == 0 {
+        return true
+    }
+    for _, o := range oses {
+        o = strings.ToLower(o)
+        if name, ok := goosNames[o]; ok {
+            o = name
+        }
+        if o == osname {
+            return true
+        }
+    }
+    return false
+}
+
+// contains reports whether list holds s.
+func contains(list []string, s string) bool {
+    for _, l := range list {
+        if l == s {
+            return true
+        }
+    }
+    return false
+}
+
+// appendUnique appends the elements of add that are not already in list.
+func appendUnique(list []string, add ...string) []string {
+    for _, a := range add {
+        if !contains(list, a) {
+            list = append(list, a)
+        }
+    }
+    return list
+}
+
+// pageVariants returns the os and lang search chains from the os, lang and
+// os-fallback config keys, detecting the os and lang when they are unset.
+func pageVariants(opts map[string]interface{}) variants {
+    osname, _ := opts["os"].(string)
+    if osname == "" {
+        osname = detectOS()
+    }
+    lang, _ := opts["lang"].(string)
+    if lang == "" {
+        lang = detectLang()
+    }
+    fallback := defaultOSFallback
+    if v, ok := opts["os-fallback"].([]interface{}); ok {
+        fallback = nil
+        for _, f := range v {
+            if s, ok := f.(string); ok {
+                fallback = append(fallback, s)
+            }
+        }
+    }
+    return variants{oses: osChain(osname, fallback), langs: langChain(lang)}
+}
+
+// variantNotice returns a Markdown note when ref is a system man page or not
+// the os or language that was asked for, or the empty string otherwise.
+func variantNotice(ref pageRef, v variants) string {
+    switch ref.source {
+    case "man":
+        return fmt.Sprintf("> **Note:** no gman page for *%s* was found; showing the system man page.\n\n", ref.name)
+    case "help":
+        // The page says where it came from.
+        return ""
+    }
+    var missing, shown []string
+    if ref.os != v.oses[0] {
+        missing = append(missing, v.oses[0])
+        shown = append(shown, ref.os)
+    }
+    if baseLang(ref.lang) != baseLang(v.langs[0]) {
+        missing = append(missing, v.langs[0])
+        shown = append(shown, ref.lang)
+    }
+    if len(missing) == 0 {
+        return ""
+    }
+    return fmt.Sprintf("> **Note:** no %s page for *%s* was found; showing the %s page.\n\n",
+        strings.Join(missing, "/"), ref.name, strings.Join(shown, "/"))
+}
+
+// baseLang returns the language part of a lang directory name.
+func baseLang(lang string) string {
+    return strings.SplitN(lang, "_", 2)[0]
+}
@@ -0,0 +1,17 @@
+// Copyright 2014 The Gman Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in LICENSE file.
+
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+
+package main
+
+import (
+    "os" // for the terminal file
+)
+
+// terminalWidth returns 0: the width of the terminal is not known on this
+// system, so COLUMNS or the width option is used.
+func terminalWidth(f *os.File) int {
+    return 0
+}
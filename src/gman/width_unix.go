@@ -0,0 +1,27 @@
+// Copyright 2014 The Gman Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in LICENSE file.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package main
+
+import (
+    "os"      // for the terminal file
+    "syscall" // for asking the terminal its size
+    "unsafe"  // for passing the window size to ioctl
+)
+
+// terminalWidth returns the number of columns of the terminal f is, or 0
+// if f is not a terminal.
+func terminalWidth(f *os.File) int {
+    var size struct {
+        rows, cols, xpixel, ypixel uint16
+    }
+    _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(),
+        uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&size)))
+    if errno != 0 {
+        return 0
+    }
+    return int(size.cols)
+}
@@ -0,0 +1,466 @@
+// Copyright 2014 The Gman Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in LICENSE file.
+
+// highlight
+// Package for splitting the code of fenced code blocks into tokens for
+// syntax highlighting.
+
+package highlight
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Kind is the kind of a token, which decides how it is highlighted.
+type Kind int
+
+const (
+	Text     Kind = iota // anything not highlighted
+	Comment              // comments
+	Keyword              // keywords and literals such as true and null
+	String               // quoted strings
+	Number               // numbers
+	Variable             // shell variables and YAML anchors and aliases
+	Command              // the command a shell line runs
+	Option               // command line options such as -s or --debug
+	Operator             // shell pipes, redirections and separators
+	Key                  // JSON and YAML object keys
+	Builtin              // Go predeclared types and functions
+	Inserted             // lines a diff adds
+	Deleted              // lines a diff removes
+	Meta                 // diff file and hunk headers, YAML document markers
+)
+
+// kindNames are the names of the kinds of token.
+var kindNames = []string{
+	"text", "comment", "keyword", "string", "number", "variable", "command",
+	"option", "operator", "key", "builtin", "inserted", "deleted", "meta",
+}
+
+// String returns the name of k, such as "comment".
+func (k Kind) String() string {
+	if k >= 0 && int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return "text"
+}
+
+// Token is a run of code of one kind.
+type Token struct {
+	Kind Kind
+	Text string
+}
+
+// lexers split code in each language into tokens.
+var lexers = map[string]func(code string) []Token{
+	"sh":   lexShell,
+	"json": lexJSON,
+	"yaml": lexYAML,
+	"go":   lexGo,
+	"diff": lexDiff,
+}
+
+// aliases are the other names a fence may give a language by.
+var aliases = map[string]string{
+	"bash":    "sh",
+	"shell":   "sh",
+	"zsh":     "sh",
+	"console": "sh",
+	"yml":     "yaml",
+	"golang":  "go",
+	"patch":   "diff",
+}
+
+// Language returns the language named by the info string of a code fence,
+// such as "sh" for "bash" or "shell", or "" if there is no lexer for it.
+func Language(info string) string {
+	fields := strings.Fields(strings.ToLower(info))
+	if len(fields) == 0 {
+		return ""
+	}
+	lang := fields[0]
+	if alias, ok := aliases[lang]; ok {
+		lang = alias
+	}
+	if _, ok := lexers[lang]; !ok {
+		return ""
+	}
+	return lang
+}
+
+// Tokens splits code in lang, as Language names it, into tokens whose texts
+// make up the code. It returns nil if there is no lexer for lang.
+func Tokens(lang, code string) []Token {
+	lex, ok := lexers[lang]
+	if !ok {
+		return nil
+	}
+	return lex(code)
+}
+
+// tokens collects tokens, joining runs of the same kind.
+type tokens []Token
+
+func (ts *tokens) add(kind Kind, text string) {
+	if text == "" {
+		return
+	}
+	if n := len(*ts); n > 0 && (*ts)[n-1].Kind == kind {
+		(*ts)[n-1].Text += text
+		return
+	}
+	*ts = append(*ts, Token{kind, text})
+}
+
+// lines splits code into lines, each keeping its newline.
+func lines(code string) []string {
+	var result []string
+	for code != "" {
+		end := strings.IndexByte(code, '\n') + 1
+		if end == 0 {
+			end = len(code)
+		}
+		result = append(result, code[:end])
+		code = code[end:]
+	}
+	return result
+}
+
+// quoted returns the length of the string quoted by code[0] at the start of
+// code, up to its end if it is not closed. With escapes, a backslash
+// escapes the next byte.
+func quoted(code string, escapes bool) int {
+	q := code[0]
+	for i := 1; i < len(code); i++ {
+		switch {
+		case code[i] == '\\' && escapes:
+			i++
+		case code[i] == q:
+			return i + 1
+		}
+	}
+	return len(code)
+}
+
+// shellKeywords are the reserved words of the shell.
+var shellKeywords = map[string]bool{
+	"if": true, "then": true, "else": true, "elif": true, "fi": true,
+	"for": true, "while": true, "until": true, "do": true, "done": true,
+	"case": true, "esac": true, "in": true, "function": true, "select": true,
+	"time": true, "!": true, "{": true, "}": true,
+}
+
+// shellAssignRe matches a variable assignment, such as LANG=C, before a
+// command.
+var shellAssignRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+// shellVarRe matches a variable reference after its $: a name, a digit, a
+// special parameter or a braced expression.
+var shellVarRe = regexp.MustCompile(`^(?:[A-Za-z_][A-Za-z0-9_]*|[0-9?#@*$!-]|\{[^}]*\}?)`)
+
+// shellPlaceholderRe matches a placeholder in a synopsis, such as <file>.
+var shellPlaceholderRe = regexp.MustCompile(`^<[A-Za-z][A-Za-z0-9_.-]*>`)
+
+// lexShell splits shell commands, as typed or in scripts or synopses. The
+// first word of each command is the command it runs, and the words that
+// start with a dash are options. In a synopsis, placeholders such as <file>
+// are not redirections, nor is a bar between brackets a pipe.
+func lexShell(code string) []Token {
+	var ts tokens
+	command := true
+	brackets := 0
+	for i := 0; i < len(code); {
+		c := code[i]
+		switch {
+		case c == '\n':
+			ts.add(Text, "\n")
+			command = true
+			i++
+		case c == ' ' || c == '\t':
+			ts.add(Text, code[i:i+1])
+			i++
+		case c == '\\' && i+1 < len(code):
+			ts.add(Text, code[i:i+2])
+			i += 2
+		case c == '#':
+			end := strings.IndexByte(code[i:], '\n')
+			if end < 0 {
+				end = len(code) - i
+			}
+			ts.add(Comment, code[i:i+end])
+			i += end
+		case c == '\'' || c == '"' || c == '`':
+			n := quoted(code[i:], c != '\'')
+			ts.add(String, code[i:i+n])
+			command = false
+			i += n
+		case c == '$' && strings.HasPrefix(code[i:], "$("):
+			ts.add(Operator, "$(")
+			command = true
+			i += 2
+		case c == '$' && shellVarRe.MatchString(code[i+1:]):
+			n := 1 + len(shellVarRe.FindString(code[i+1:]))
+			ts.add(Variable, code[i:i+n])
+			command = false
+			i += n
+		case c == '$':
+			// A prompt, as in "$ gman tar", comes before the command.
+			ts.add(Text, "$")
+			i++
+		case c == '<' && shellPlaceholderRe.MatchString(code[i:]):
+			n := len(shellPlaceholderRe.FindString(code[i:]))
+			ts.add(Text, code[i:i+n])
+			command = false
+			i += n
+		case c == '|' && brackets > 0:
+			ts.add(Text, "|")
+			i++
+		case strings.IndexByte("|&;<>()", c) >= 0:
+			start := i
+			for i < len(code) && strings.IndexByte("|&;<>()", code[i]) >= 0 {
+				i++
+			}
+			op := code[start:i]
+			ts.add(Operator, op)
+			command = strings.ContainsAny(op, "|&;(") && !strings.ContainsAny(op, "<>")
+		default:
+			start := i
+			for i < len(code) && strings.IndexByte(" \t\n|&;<>()'\"`$", code[i]) < 0 {
+				if code[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i == start {
+				i++
+			}
+			if i > len(code) {
+				i = len(code)
+			}
+			word := code[start:i]
+			if brackets += strings.Count(word, "[") - strings.Count(word, "]"); brackets < 0 {
+				brackets = 0
+			}
+			option := strings.TrimLeft(word, "[")
+			switch {
+			case command && shellKeywords[word]:
+				ts.add(Keyword, word)
+			case command && shellAssignRe.MatchString(word):
+				eq := strings.IndexByte(word, '=')
+				ts.add(Variable, word[:eq])
+				ts.add(Text, word[eq:])
+			case command:
+				ts.add(Command, word)
+				command = false
+			case len(option) > 1 && option[0] == '-' && option[1] != ']':
+				ts.add(Text, word[:len(word)-len(option)])
+				name := strings.TrimRight(option, "]")
+				ts.add(Option, name)
+				ts.add(Text, option[len(name):])
+			default:
+				ts.add(Text, word)
+			}
+		}
+	}
+	return ts
+}
+
+// jsonNumberRe matches a JSON number.
+var jsonNumberRe = regexp.MustCompile(`^-?[0-9]+(?:\.[0-9]+)?(?:[eE][+-]?[0-9]+)?`)
+
+// lexJSON splits JSON. A string followed by a colon is an object key.
+func lexJSON(code string) []Token {
+	var ts tokens
+	for i := 0; i < len(code); {
+		rest := code[i:]
+		switch {
+		case rest[0] == '"':
+			n := quoted(rest, true)
+			kind := String
+			if strings.HasPrefix(strings.TrimLeft(rest[n:], " \t\r\n"), ":") {
+				kind = Key
+			}
+			ts.add(kind, rest[:n])
+			i += n
+		case jsonNumberRe.MatchString(rest):
+			n := len(jsonNumberRe.FindString(rest))
+			ts.add(Number, rest[:n])
+			i += n
+		case strings.HasPrefix(rest, "true"), strings.HasPrefix(rest, "null"):
+			ts.add(Keyword, rest[:4])
+			i += 4
+		case strings.HasPrefix(rest, "false"):
+			ts.add(Keyword, rest[:5])
+			i += 5
+		default:
+			ts.add(Text, rest[:1])
+			i++
+		}
+	}
+	return ts
+}
+
+// yamlLineRe splits a line of YAML into its indent and list markers, an
+// optional key and its colon, and the value.
+var yamlLineRe = regexp.MustCompile(`^([ \t]*(?:-[ \t]+)*)(?:("[^"]*"|'[^']*'|[^\s#'"{\[][^:#]*?)(:)(?:[ \t]|$))?(.*)$`)
+
+// yamlKeywords are the YAML scalars that are not strings.
+var yamlKeywords = map[string]bool{
+	"true": true, "false": true, "yes": true, "no": true, "on": true, "off": true,
+	"null": true, "~": true,
+}
+
+// yamlNumberRe matches a YAML number.
+var yamlNumberRe = regexp.MustCompile(`^[-+]?(?:[0-9][0-9_]*(?:\.[0-9]*)?(?:[eE][-+]?[0-9]+)?|0x[0-9a-fA-F]+|\.inf|\.nan)$`)
+
+// lexYAML splits YAML a line at a time: comments, document markers, keys
+// and the scalar values after them.
+func lexYAML(code string) []Token {
+	var ts tokens
+	for _, line := range lines(code) {
+		text := strings.TrimRight(line, "\r\n")
+		newline := line[len(text):]
+		trimmed := strings.TrimSpace(text)
+		switch {
+		case strings.HasPrefix(trimmed, "#"):
+			ts.add(Text, text[:len(text)-len(strings.TrimLeft(text, " \t"))])
+			ts.add(Comment, strings.TrimLeft(text, " \t"))
+		case trimmed == "---" || trimmed == "...":
+			ts.add(Meta, text)
+		default:
+			m := yamlLineRe.FindStringSubmatch(text)
+			ts.add(Text, m[1])
+			if m[3] != "" {
+				ts.add(Key, m[2])
+				ts.add(Text, m[3]+text[len(m[1])+len(m[2])+len(m[3]):len(text)-len(m[4])])
+			}
+			lexYAMLValue(&ts, m[4])
+		}
+		ts.add(Text, newline)
+	}
+	return ts
+}
+
+// lexYAMLValue splits the value of a line of YAML and any comment after it.
+func lexYAMLValue(ts *tokens, value string) {
+	comment := ""
+	if value != "" && (value[0] == '"' || value[0] == '\'') {
+		n := quoted(value, value[0] == '"')
+		ts.add(String, value[:n])
+		value = value[n:]
+	}
+	if i := strings.Index(" "+value, " #"); i >= 0 {
+		value, comment = value[:i], value[i:]
+	}
+	word := strings.TrimSpace(value)
+	start := strings.Index(value, word)
+	ts.add(Text, value[:start])
+	switch {
+	case yamlKeywords[strings.ToLower(word)]:
+		ts.add(Keyword, word)
+	case yamlNumberRe.MatchString(word):
+		ts.add(Number, word)
+	case strings.HasPrefix(word, "&"), strings.HasPrefix(word, "*"):
+		ts.add(Variable, word)
+	default:
+		ts.add(Text, word)
+	}
+	ts.add(Text, value[start+len(word):])
+	ts.add(Comment, comment)
+}
+
+// goKeywords are the keywords of Go.
+var goKeywords = map[string]bool{
+	"break": true, "case": true, "chan": true, "const": true, "continue": true,
+	"default": true, "defer": true, "else": true, "fallthrough": true,
+	"for": true, "func": true, "go": true, "goto": true, "if": true,
+	"import": true, "interface": true, "map": true, "package": true,
+	"range": true, "return": true, "select": true, "struct": true,
+	"switch": true, "type": true, "var": true,
+}
+
+// goBuiltins are the predeclared identifiers of Go.
+var goBuiltins = map[string]bool{
+	"any": true, "bool": true, "byte": true, "comparable": true,
+	"complex64": true, "complex128": true, "error": true, "float32": true,
+	"float64": true, "int": true, "int8": true, "int16": true, "int32": true,
+	"int64": true, "rune": true, "string": true, "uint": true, "uint8": true,
+	"uint16": true, "uint32": true, "uint64": true, "uintptr": true,
+	"true": true, "false": true, "iota": true, "nil": true,
+	"append": true, "cap": true, "clear": true, "close": true, "complex": true,
+	"copy": true, "delete": true, "imag": true, "len": true, "make": true,
+	"max": true, "min": true, "new": true, "panic": true, "print": true,
+	"println": true, "real": true, "recover": true,
+}
+
+// goWordRe matches a Go identifier or number.
+var goWordRe = regexp.MustCompile(`^(?:[\p{L}_][\p{L}\p{Nd}_]*|[0-9](?:[eEpP][-+]|[0-9a-zA-Z_.])*|\.[0-9][0-9_]*(?:[eE][-+]?[0-9_]+)?)`)
+
+// lexGo splits Go source.
+func lexGo(code string) []Token {
+	var ts tokens
+	for i := 0; i < len(code); {
+		rest := code[i:]
+		switch {
+		case strings.HasPrefix(rest, "//"):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			ts.add(Comment, rest[:end])
+			i += end
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				end = len(rest)
+			} else {
+				end += 4
+			}
+			ts.add(Comment, rest[:end])
+			i += end
+		case rest[0] == '"' || rest[0] == '`' || rest[0] == '\'':
+			n := quoted(rest, rest[0] != '`')
+			ts.add(String, rest[:n])
+			i += n
+		case goWordRe.MatchString(rest):
+			word := goWordRe.FindString(rest)
+			switch {
+			case word[0] == '.' || word[0] >= '0' && word[0] <= '9':
+				ts.add(Number, word)
+			case goKeywords[word]:
+				ts.add(Keyword, word)
+			case goBuiltins[word]:
+				ts.add(Builtin, word)
+			default:
+				ts.add(Text, word)
+			}
+			i += len(word)
+		default:
+			ts.add(Text, rest[:1])
+			i++
+		}
+	}
+	return ts
+}
+
+// lexDiff splits a unified or context diff a line at a time.
+func lexDiff(code string) []Token {
+	var ts tokens
+	for _, line := range lines(code) {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"),
+			strings.HasPrefix(line, "@@"), strings.HasPrefix(line, "diff "),
+			strings.HasPrefix(line, "index "), strings.HasPrefix(line, "***"):
+			ts.add(Meta, line)
+		case strings.HasPrefix(line, "+"), strings.HasPrefix(line, ">"):
+			ts.add(Inserted, line)
+		case strings.HasPrefix(line, "-"), strings.HasPrefix(line, "<"):
+			ts.add(Deleted, line)
+		default:
+			ts.add(Text, line)
+		}
+	}
+	return ts
+}
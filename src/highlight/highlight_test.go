@@ -0,0 +1,76 @@
+package highlight
+
+import (
+	"strings"
+	"testing"
+)
+
+// kinds returns the tokens of code in lang as "kind:text" strings, leaving
+// out plain text.
+func kinds(t *testing.T, lang, code string) []string {
+	var got []string
+	var all strings.Builder
+	for _, tok := range Tokens(lang, code) {
+		all.WriteString(tok.Text)
+		if tok.Kind != Text {
+			got = append(got, tok.Kind.String()+":"+tok.Text)
+		}
+	}
+	if all.String() != code {
+		t.Errorf("%s tokens make up %q, not %q", lang, all.String(), code)
+	}
+	return got
+}
+
+func TestHighlight_Language(t *testing.T) {
+	for info, want := range map[string]string{
+		"sh":              "sh",
+		"bash":            "sh",
+		"Shell title=foo": "sh",
+		"yml":             "yaml",
+		"json":            "json",
+		"go":              "go",
+		"patch":           "diff",
+		"python":          "",
+		"":                "",
+	} {
+		if got := Language(info); got != want {
+			t.Errorf("Language(%q) = %q, want %q", info, got, want)
+		}
+	}
+	if Tokens("python", "x = 1") != nil {
+		t.Error("Tokens returned tokens for a language without a lexer")
+	}
+}
+
+func TestHighlight_Lexers(t *testing.T) {
+	tests := []struct {
+		lang, code string
+		want       []string
+	}{
+		{"sh", "$ gman -s Summary tar | less # page\nLANG=C ls \"$HOME\" ${PATH}",
+			[]string{"command:gman", "option:-s", "operator:|", "command:less", "comment:# page",
+				"variable:LANG", "command:ls", "string:\"$HOME\"", "variable:${PATH}"}},
+		{"sh", "gman [-a | --all] [-s <docsection>]... <page>",
+			[]string{"command:gman", "option:-a", "option:--all", "option:-s"}},
+		{"sh", "if true; then\n  echo $(date) 'a b'\nfi",
+			[]string{"keyword:if", "command:true", "operator:;", "keyword:then", "command:echo",
+				"operator:$(", "command:date", "operator:)", "string:'a b'", "keyword:fi"}},
+		{"json", "{\"width\": 80, \"color\": \"auto\", \"on\": true}",
+			[]string{"key:\"width\"", "number:80", "key:\"color\"", "string:\"auto\"", "key:\"on\"", "keyword:true"}},
+		{"yaml", "---\n# pages\nname: gman\nsection: 1 # user\ntags:\n  - \"help\"\nsee: *ref\n",
+			[]string{"meta:---", "comment:# pages", "key:name", "key:section", "number:1", "comment:# user",
+				"key:tags", "string:\"help\"", "key:see", "variable:*ref"}},
+		{"go", "// pick returns\nfunc pick(a int) string { return \"x\" + 0x1f }",
+			[]string{"comment:// pick returns", "keyword:func", "builtin:int", "builtin:string",
+				"keyword:return", "string:\"x\"", "number:0x1f"}},
+		{"diff", "--- a/gman.go\n+++ b/gman.go\n@@ -1 +1 @@\n-old\n+new\n same\n",
+			[]string{"meta:--- a/gman.go\n+++ b/gman.go\n@@ -1 +1 @@\n", "deleted:-old\n", "inserted:+new\n"}},
+	}
+	for _, test := range tests {
+		got := kinds(t, test.lang, test.code)
+		if strings.Join(got, "|") != strings.Join(test.want, "|") {
+			t.Errorf("%s tokens of %q:\n got %q\nwant %q", test.lang, test.code, got, test.want)
+		}
+	}
+}
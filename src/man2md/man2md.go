@@ -11,6 +11,7 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"log"
 	"regexp"
 	"sort"
 	"strings"
@@ -84,9 +85,9 @@ func (parser *Man2mdParser) Parse() (err error) {
 
 	// dsn debug
 	// Dump the list of unprocessed commands.
-	fmt.Printf("\n%d unprocessed dot commands:\n", len(parser.unprocessedCmds))
+	log.Printf("%d unprocessed dot commands:\n", len(parser.unprocessedCmds))
 	for _, cmd := range parser.unprocessedCmds {
-		fmt.Printf("\t%s\n", cmd)
+		log.Printf("\t%s\n", cmd)
 	}
 	// end dsn debug
 
@@ -0,0 +1,156 @@
+// Copyright 2014 The Gman Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in LICENSE file.
+
+package mandown
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Meta is the metadata a page may declare in front matter: a block of
+// YAML between "---" lines at the very top of the page, as in
+//
+//	---
+//	name: gzip
+//	description: compress or expand files
+//	aliases: [gunzip, zcat]
+//	see-also:
+//	  - tar(1)
+//	---
+//
+// Keys not listed here are ignored.
+type Meta struct {
+	Name        string   `json:"name,omitempty"`
+	Section     string   `json:"section,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Aliases     []string `json:"aliases,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	OS          []string `json:"os,omitempty"`
+	SeeAlso     []string `json:"see-also,omitempty"`
+	Version     string   `json:"version,omitempty"`  // version of the documented tool
+	Authors     []string `json:"authors,omitempty"`  // page authors
+	Reviewed    string   `json:"reviewed,omitempty"` // last-reviewed date, as written
+}
+
+// listKeys are the keys whose values are lists.
+var listKeys = map[string]bool{
+	"aliases":  true,
+	"tags":     true,
+	"os":       true,
+	"see-also": true,
+	"authors":  true,
+}
+
+// SplitFrontMatter separates the front matter of a page from its body. A
+// page without front matter gives an empty Meta and the whole input as
+// body. Only the simple YAML that metadata needs is understood: "key: value"
+// scalars, optionally quoted, lists written either as "[a, b]", as comma
+// separated values or as "- item" lines, and "#" comments. On a malformed
+// line the body is still split off and the error says where.
+func SplitFrontMatter(input []byte) (Meta, []byte, error) {
+	var meta Meta
+	text := string(input)
+	first := strings.SplitN(text, "\n", 2)
+	if len(first) < 2 || strings.TrimRight(first[0], " \t\r") != "---" {
+		return meta, input, nil
+	}
+	lines := strings.Split(first[1], "\n")
+	end := -1
+	for i, line := range lines {
+		if line = strings.TrimRight(line, " \t\r"); line == "---" || line == "..." {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return meta, input, nil
+	}
+	body := []byte(strings.Join(lines[end+1:], "\n"))
+
+	fields := make(map[string][]string)
+	var key string
+	for i, line := range lines[:end] {
+		line = stripComment(strings.TrimRight(line, " \t\r"))
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "#"):
+		case strings.HasPrefix(trimmed, "- ") || trimmed == "-":
+			if key == "" {
+				return meta, body, fmt.Errorf("front matter line %d: list item without a key", i+2)
+			}
+			fields[key] = append(fields[key], unquote(strings.TrimSpace(trimmed[1:])))
+		default:
+			colon := strings.Index(line, ":")
+			if colon <= 0 || line[0] == ' ' || line[0] == '\t' {
+				return meta, body, fmt.Errorf("front matter line %d: want \"key: value\"", i+2)
+			}
+			key = strings.ToLower(strings.TrimSpace(line[:colon]))
+			fields[key] = nil
+			value := strings.TrimSpace(line[colon+1:])
+			switch {
+			case value == "":
+			case listKeys[key]:
+				fields[key] = splitList(value)
+			default:
+				fields[key] = []string{unquote(value)}
+			}
+		}
+	}
+
+	scalar := func(key string) string {
+		return strings.Join(fields[key], ", ")
+	}
+	meta.Name = scalar("name")
+	meta.Section = scalar("section")
+	meta.Description = scalar("description")
+	meta.Aliases = fields["aliases"]
+	meta.Tags = fields["tags"]
+	meta.OS = fields["os"]
+	meta.SeeAlso = fields["see-also"]
+	meta.Version = scalar("version")
+	meta.Authors = fields["authors"]
+	meta.Reviewed = scalar("last-reviewed")
+	return meta, body, nil
+}
+
+// splitList returns the items of a "[a, b]" flow list or of a comma
+// separated scalar. A quoted scalar is a single item.
+func splitList(value string) []string {
+	if len(value) > 1 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return []string{unquote(value)}
+	}
+	if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+		value = value[1 : len(value)-1]
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = unquote(strings.TrimSpace(item)); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// stripComment removes a "#" comment, preceded by white space, from the
+// end of a line that has no quotes.
+func stripComment(line string) string {
+	if strings.ContainsAny(line, `"'`) {
+		return line
+	}
+	for i := 1; i < len(line); i++ {
+		if line[i] == '#' && (line[i-1] == ' ' || line[i-1] == '\t') {
+			return strings.TrimRight(line[:i], " \t")
+		}
+	}
+	return line
+}
+
+// unquote removes matching single or double quotes around s.
+func unquote(s string) string {
+	if len(s) > 1 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
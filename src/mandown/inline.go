@@ -0,0 +1,215 @@
+// Copyright 2014 The Gman Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in LICENSE file.
+
+package mandown
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SpanKind is the kind of a span of inline text.
+type SpanKind int
+
+const (
+	Plain          SpanKind = iota // text without markup
+	Emphasis                       // *text* or _text_
+	Strong                         // **text** or __text__
+	StrongEmphasis                 // ***text*** or ___text___
+	CodeSpan                       // `text`
+	Link                           // [text](url) or <url>
+	Image                          // ![alt](url)
+	HTML                           // an inline HTML tag such as <img src="x.png"/>
+)
+
+// Span is a run of inline text. Markup nested inside emphasis, strong text
+// and links is dropped.
+type Span struct {
+	Kind SpanKind
+	Text string
+	URL  string // target of a link or image
+}
+
+var (
+	// autolinkRe matches an autolink such as <http://example.com>.
+	autolinkRe = regexp.MustCompile(`^<((?:https?|ftp|mailto|gman):[^\s<>]+)>`)
+
+	// htmlTagRe matches an inline HTML tag.
+	htmlTagRe = regexp.MustCompile(`^</?[a-zA-Z][^<>]*>`)
+
+	// inlineLinkRe matches the "(url)" or "(url "title")" after link text.
+	// The url may hold a pair of parentheses, as in gman://zip(1).
+	inlineLinkRe = regexp.MustCompile(`^\(\s*<?([^\s()<>]*(?:\([^\s()<>]*\)[^\s()<>]*)?)>?(?:\s+"[^"]*")?\s*\)`)
+)
+
+// Inline splits inline Markdown into spans. As in the renderer gman uses,
+// emphasis markers inside words are text.
+func Inline(text string) []Span {
+	var spans []Span
+	var plain strings.Builder
+	add := func(s Span) {
+		if plain.Len() > 0 {
+			spans = append(spans, Span{Kind: Plain, Text: plain.String()})
+			plain.Reset()
+		}
+		spans = append(spans, s)
+	}
+	for i := 0; i < len(text); {
+		c := text[i]
+		rest := text[i:]
+		switch {
+		case c == '\\' && i+1 < len(text) && isPunct(text[i+1]):
+			plain.WriteByte(text[i+1])
+			i += 2
+			continue
+		case c == '`':
+			n := runLength(rest, '`')
+			if end := strings.Index(rest[n:], strings.Repeat("`", n)); end >= 0 {
+				add(Span{Kind: CodeSpan, Text: strings.TrimSpace(rest[n : n+end])})
+				i += 2*n + end
+				continue
+			}
+			plain.WriteString(rest[:n])
+			i += n
+			continue
+		case c == '!' && strings.HasPrefix(rest, "!["):
+			if label, url, n, ok := link(rest[1:]); ok {
+				add(Span{Kind: Image, Text: label, URL: url})
+				i += 1 + n
+				continue
+			}
+		case c == '[':
+			if label, url, n, ok := link(rest); ok {
+				add(Span{Kind: Link, Text: PlainText(Inline(label)), URL: url})
+				i += n
+				continue
+			}
+		case c == '<':
+			if m := autolinkRe.FindStringSubmatch(rest); m != nil {
+				add(Span{Kind: Link, Text: m[1], URL: m[1]})
+				i += len(m[0])
+				continue
+			}
+			if m := htmlTagRe.FindString(rest); m != "" {
+				add(Span{Kind: HTML, Text: m})
+				i += len(m)
+				continue
+			}
+		case c == '*' || c == '_':
+			if s, n, ok := emphasis(text, i); ok {
+				add(s)
+				i += n
+				continue
+			}
+			n := runLength(rest, c)
+			plain.WriteString(rest[:n])
+			i += n
+			continue
+		}
+		plain.WriteByte(c)
+		i++
+	}
+	if plain.Len() > 0 {
+		spans = append(spans, Span{Kind: Plain, Text: plain.String()})
+	}
+	return spans
+}
+
+// PlainText returns the text of spans without markup. HTML tags are
+// dropped and images give their alternative text.
+func PlainText(spans []Span) string {
+	var b strings.Builder
+	for _, s := range spans {
+		if s.Kind != HTML {
+			b.WriteString(s.Text)
+		}
+	}
+	return b.String()
+}
+
+// link parses "[label](url)" at the start of s and returns the label, the
+// url and the length of the link.
+func link(s string) (string, string, int, bool) {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				m := inlineLinkRe.FindStringSubmatch(s[i+1:])
+				if m == nil {
+					return "", "", 0, false
+				}
+				return s[1:i], m[1], i + 1 + len(m[0]), true
+			}
+		}
+	}
+	return "", "", 0, false
+}
+
+// emphasis parses emphasis, strong text or both, opened by a run of one,
+// two or three markers at text[i], and returns the span and its length in
+// text.
+func emphasis(text string, i int) (Span, int, bool) {
+	c := text[i]
+	n := runLength(text[i:], c)
+	if n > 3 {
+		n = 3
+	}
+	open := i + n
+	if isWordBefore(text, i) || open >= len(text) || text[open] == ' ' || text[open] == '\t' {
+		return Span{}, 0, false
+	}
+	marker := strings.Repeat(string(c), n)
+	for j := open + 1; j+n <= len(text); j++ {
+		if !strings.HasPrefix(text[j:], marker) || text[j-1] == ' ' || text[j-1] == '\t' {
+			continue
+		}
+		if isWordAfter(text, j+n) || n == 1 && j+1 < len(text) && text[j+1] == c {
+			continue
+		}
+		kind := Emphasis
+		switch n {
+		case 2:
+			kind = Strong
+		case 3:
+			kind = StrongEmphasis
+		}
+		return Span{Kind: kind, Text: PlainText(Inline(text[open:j]))}, j + n - i, true
+	}
+	return Span{}, 0, false
+}
+
+// runLength returns how many times c repeats at the start of s.
+func runLength(s string, c byte) int {
+	n := 0
+	for n < len(s) && s[n] == c {
+		n++
+	}
+	return n
+}
+
+// isWordBefore reports whether the character before text[i] is part of a
+// word.
+func isWordBefore(text string, i int) bool {
+	r, _ := utf8.DecodeLastRuneInString(text[:i])
+	return i > 0 && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// isWordAfter reports whether the character at text[i] is part of a word.
+func isWordAfter(text string, i int) bool {
+	r, _ := utf8.DecodeRuneInString(text[i:])
+	return i < len(text) && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// isPunct reports whether c may be escaped with a backslash.
+func isPunct(c byte) bool {
+	return strings.IndexByte("\\`*_{}[]()#+-.!<>|", c) >= 0
+}
@@ -0,0 +1,351 @@
+// Copyright 2014 The Gman Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in LICENSE file.
+
+// mandown
+// Package for scanning the block structure of Mandown (gman Markdown) pages.
+//
+// The scanner follows the block rules of the Markdown renderer used by gman,
+// so that headings are found exactly where the renderer sees them: ATX
+// ("## Options") and Setext (underlined with "===" or "---") headings are
+// recognized, while lines inside fenced or indented code are not.
+
+package mandown
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// titleRe matches the titles ParseTitle splits.
+var titleRe = regexp.MustCompile(`^(.+?)\(([^()\s]+)\)(?:\s+-{1,2}\s+(.*))?$`)
+
+// Kind is the kind of a block.
+type Kind int
+
+const (
+	Text     Kind = iota // paragraph text and anything else
+	Blank                // one or more blank lines
+	Heading              // ATX or Setext heading
+	Code                 // fenced or indented code block
+	Rule                 // horizontal rule
+	ListItem             // list item, including its continuation lines
+)
+
+// Block is a run of lines of one kind.
+type Block struct {
+	Kind  Kind
+	Level int    // heading level, 1 to 6
+	Title string // heading text without markers
+	Info  string // info string of a fenced code block, e.g. "sh"
+	Start int    // index of the first line of the block
+	End   int    // index of the line after the block
+}
+
+// Doc is a scanned page.
+type Doc struct {
+	Lines  []string
+	Blocks []Block
+}
+
+// Parse scans input into blocks.
+func Parse(input []byte) *Doc {
+	text := strings.Replace(string(input), "\r\n", "\n", -1)
+	text = strings.TrimSuffix(text, "\n")
+	doc := &Doc{}
+	if text != "" {
+		doc.Lines = strings.Split(text, "\n")
+	}
+	doc.scan()
+	return doc
+}
+
+// Headings returns the heading blocks in document order.
+func (doc *Doc) Headings() []Block {
+	var headings []Block
+	for _, b := range doc.Blocks {
+		if b.Kind == Heading {
+			headings = append(headings, b)
+		}
+	}
+	return headings
+}
+
+// SectionEnd returns the index of the line after the section started by
+// heading h, which runs until the next heading of the same or a higher
+// level.
+func (doc *Doc) SectionEnd(h Block) int {
+	for _, b := range doc.Blocks {
+		if b.Kind == Heading && b.Start > h.Start && b.Level <= h.Level {
+			return b.Start
+		}
+	}
+	return len(doc.Lines)
+}
+
+// Section is a heading with the sections nested below it.
+type Section struct {
+	Heading  Block
+	Slug     string // anchor for the heading, unique within the page
+	Children []*Section
+}
+
+// Outline returns the heading tree of the page. A heading is nested below
+// the nearest preceding heading of a higher level.
+func (doc *Doc) Outline() []*Section {
+	var roots []*Section
+	var stack []*Section
+	used := make(map[string]int)
+	for _, h := range doc.Headings() {
+		sec := &Section{Heading: h, Slug: uniqueSlug(h.Title, used)}
+
+		for len(stack) > 0 && stack[len(stack)-1].Heading.Level >= h.Level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			roots = append(roots, sec)
+		} else {
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, sec)
+		}
+		stack = append(stack, sec)
+	}
+	return roots
+}
+
+// Slug returns an anchor name for a heading in the style used by GitHub:
+// lower case, spaces turned into dashes and punctuation other than dashes
+// and underscores dropped. "-b, --browse" becomes "-b---browse".
+func Slug(title string) string {
+	var slug []rune
+	for _, r := range strings.ToLower(strings.TrimSpace(title)) {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), r == '-', r == '_':
+			slug = append(slug, r)
+		case r == ' ':
+			slug = append(slug, '-')
+		}
+	}
+	return string(slug)
+}
+
+// ParseTitle splits a title into the page name, section and description it
+// gives, as in "gman(1) - A better help system" or the Ronn style
+// "gman-mandown(7) -- Gman manual markdown format". The description may be
+// left out, as in "gzip(1)"; ok is false when there is no name(section).
+func ParseTitle(title string) (name, section, description string, ok bool) {
+	m := titleRe.FindStringSubmatch(title)
+	if m == nil {
+		return "", "", "", false
+	}
+	return m[1], m[2], m[3], true
+}
+
+// Source returns lines [start, end) joined by newlines.
+func (doc *Doc) Source(start, end int) string {
+	return strings.Join(doc.Lines[start:end], "\n")
+}
+
+func (doc *Doc) scan() {
+	lines := doc.Lines
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		prev := doc.last()
+		switch {
+		case isBlank(line):
+			j := i + 1
+			for j < len(lines) && isBlank(lines[j]) {
+				j++
+			}
+			doc.add(Block{Kind: Blank, Start: i, End: j})
+			i = j
+
+		case atxLevel(line) > 0:
+			doc.add(Block{Kind: Heading, Level: atxLevel(line), Title: atxTitle(line), Start: i, End: i + 1})
+			i++
+
+		case fenceMarker(line) != "":
+			marker := fenceMarker(line)
+			info := strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), marker[:1]))
+			j := i + 1
+			for j < len(lines) && !closesFence(lines[j], marker) {
+				j++
+			}
+			if j < len(lines) {
+				j++ // include the closing fence
+			}
+			doc.add(Block{Kind: Code, Info: info, Start: i, End: j})
+			i = j
+
+		case prev != nil && prev.Kind == Text && underlineLevel(line) > 0:
+			// A Setext underline turns the last line of the paragraph
+			// into a heading.
+			title := strings.TrimSpace(lines[i-1])
+			if prev.End-prev.Start == 1 {
+				doc.Blocks = doc.Blocks[:len(doc.Blocks)-1]
+			} else {
+				prev.End--
+			}
+			doc.add(Block{Kind: Heading, Level: underlineLevel(line), Title: title, Start: i - 1, End: i + 1})
+			i++
+
+		case isRule(line):
+			doc.add(Block{Kind: Rule, Start: i, End: i + 1})
+			i++
+
+		case isIndented(line) && (prev == nil || prev.Kind == Blank || prev.Kind == Heading) && !doc.inList():
+			j := i + 1
+			for j < len(lines) && (isIndented(lines[j]) || isBlank(lines[j]) && j+1 < len(lines) && isIndented(lines[j+1])) {
+				j++
+			}
+			doc.add(Block{Kind: Code, Start: i, End: j})
+			i = j
+
+		case isListItem(line):
+			doc.add(Block{Kind: ListItem, Start: i, End: i + 1})
+			i++
+
+		case prev != nil && (prev.Kind == Text || prev.Kind == ListItem):
+			// Lazy continuation of a paragraph or list item.
+			prev.End++
+			i++
+
+		case prev != nil && prev.Kind == Blank && isIndented(line) && doc.inList():
+			// An indented paragraph continuing a list item.
+			doc.Blocks = doc.Blocks[:len(doc.Blocks)-1]
+			doc.last().End = i + 1
+			i++
+
+		default:
+			doc.add(Block{Kind: Text, Start: i, End: i + 1})
+			i++
+		}
+	}
+}
+
+func (doc *Doc) add(b Block) {
+	doc.Blocks = append(doc.Blocks, b)
+}
+
+func (doc *Doc) last() *Block {
+	if len(doc.Blocks) == 0 {
+		return nil
+	}
+	return &doc.Blocks[len(doc.Blocks)-1]
+}
+
+// inList reports whether the latest non-blank block is a list item.
+func (doc *Doc) inList() bool {
+	for i := len(doc.Blocks) - 1; i >= 0; i-- {
+		if doc.Blocks[i].Kind != Blank {
+			return doc.Blocks[i].Kind == ListItem
+		}
+	}
+	return false
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+func isIndented(line string) bool {
+	return strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t")
+}
+
+// atxLevel returns the level of an ATX heading line, or 0. As in the
+// renderer, no space is needed after the markers.
+func atxLevel(line string) int {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level > 6 {
+		level = 6
+	}
+	return level
+}
+
+// atxTitle returns the text of an ATX heading without its markers.
+func atxTitle(line string) string {
+	title := strings.TrimSpace(line[atxLevel(line):])
+	title = strings.TrimSpace(strings.TrimRight(title, "#"))
+	return title
+}
+
+// underlineLevel returns 1 for a "===" and 2 for a "---" Setext underline,
+// or 0.
+func underlineLevel(line string) int {
+	trimmed := strings.TrimRight(line, " \t")
+	switch {
+	case trimmed == "":
+		return 0
+	case strings.Trim(trimmed, "=") == "":
+		return 1
+	case strings.Trim(trimmed, "-") == "":
+		return 2
+	}
+	return 0
+}
+
+// isRule reports whether line is a horizontal rule such as "* * *" or "---".
+func isRule(line string) bool {
+	s := strings.TrimSpace(line)
+	if len(s) < 3 || len(line)-len(strings.TrimLeft(line, " ")) > 3 {
+		return false
+	}
+	c := s[0]
+	if c != '*' && c != '-' && c != '_' {
+		return false
+	}
+	n := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case c:
+			n++
+		case ' ':
+		default:
+			return false
+		}
+	}
+	return n >= 3
+}
+
+// isListItem reports whether line starts a bulleted or numbered list item.
+func isListItem(line string) bool {
+	s := strings.TrimLeft(line, " ")
+	if len(line)-len(s) > 3 || s == "" {
+		return false
+	}
+	if (s[0] == '*' || s[0] == '+' || s[0] == '-') && len(s) > 1 && (s[1] == ' ' || s[1] == '\t') {
+		return true
+	}
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return i > 0 && i+1 < len(s) && s[i] == '.' && (s[i+1] == ' ' || s[i+1] == '\t')
+}
+
+// fenceMarker returns the opening marker of a fenced code block, such as
+// "```" or "~~~~", or the empty string.
+func fenceMarker(line string) string {
+	s := strings.TrimLeft(line, " ")
+	if len(line)-len(s) > 3 || len(s) < 3 || (s[0] != '`' && s[0] != '~') {
+		return ""
+	}
+	n := 0
+	for n < len(s) && s[n] == s[0] {
+		n++
+	}
+	if n < 3 || s[0] == '`' && strings.Contains(s[n:], "`") {
+		return ""
+	}
+	return s[:n]
+}
+
+// closesFence reports whether line closes a block opened with marker.
+func closesFence(line, marker string) bool {
+	s := strings.TrimSpace(line)
+	return len(s) >= len(marker) && strings.Trim(s, marker[:1]) == ""
+}
@@ -0,0 +1,256 @@
+package mandown
+
+import (
+	"strings"
+	"testing"
+)
+
+func titles(doc *Doc) []string {
+	var result []string
+	for _, h := range doc.Headings() {
+		result = append(result, h.Title)
+	}
+	return result
+}
+
+func TestMandown_Headings(t *testing.T) {
+	input := `Gman-gmd(7) -- Gman manual markdown format
+==========================================
+
+## SYNOPSIS
+Some text.
+
+OPTIONS
+-------
+` + "```sh" + `
+# not a heading
+ls -l
+` + "```" + `
+
+    # not a heading either
+
+#### -b, --browse ####
+Text.`
+
+	doc := Parse([]byte(input))
+	want := []string{"Gman-gmd(7) -- Gman manual markdown format", "SYNOPSIS", "OPTIONS", "-b, --browse"}
+	got := titles(doc)
+	if len(got) != len(want) {
+		t.Fatalf("headings = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("heading %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	headings := doc.Headings()
+	if headings[0].Level != 1 || headings[2].Level != 2 || headings[3].Level != 4 {
+		t.Errorf("unexpected heading levels: %+v", headings)
+	}
+	if end := doc.SectionEnd(headings[2]); end != len(doc.Lines) {
+		t.Errorf("OPTIONS section ends at line %d, want %d", end, len(doc.Lines))
+	}
+	var codes []Block
+	for _, b := range doc.Blocks {
+		if b.Kind == Code {
+			codes = append(codes, b)
+		}
+	}
+	if len(codes) != 2 || codes[0].Info != "sh" || codes[0].End-codes[0].Start != 4 {
+		t.Errorf("code blocks = %+v, want a fenced sh block and an indented block", codes)
+	}
+}
+
+func TestMandown_SetextNeedsParagraph(t *testing.T) {
+	input := "Paragraph line one\nTitle line\n---\n\n---\n\n- item\n---"
+
+	doc := Parse([]byte(input))
+	got := titles(doc)
+	if len(got) != 1 || got[0] != "Title line" {
+		t.Fatalf("headings = %q, want [\"Title line\"]", got)
+	}
+	if first := doc.Blocks[0]; first.Kind != Text || first.End != 1 {
+		t.Errorf("paragraph before heading = %+v", first)
+	}
+}
+
+func TestMandown_ListContinuation(t *testing.T) {
+	input := "1.  Blue\n2.  Bonbon pie\n    topping.\n\n    More topping.\n\n#### Next"
+
+	doc := Parse([]byte(input))
+	for _, b := range doc.Blocks {
+		if b.Kind == Code {
+			t.Errorf("list continuation scanned as code: %+v", b)
+		}
+	}
+	if got := titles(doc); len(got) != 1 || got[0] != "Next" {
+		t.Errorf("headings = %q, want [\"Next\"]", got)
+	}
+}
+
+func TestMandown_Outline(t *testing.T) {
+	input := "# gman(1) - A better help system\n## Options\n#### -b, --browse\n#### -s\n## Options\n### Nested"
+
+	outline := Parse([]byte(input)).Outline()
+	if len(outline) != 1 || len(outline[0].Children) != 2 {
+		t.Fatalf("unexpected outline shape: %+v", outline)
+	}
+	if slug := outline[0].Slug; slug != "gman1---a-better-help-system" {
+		t.Errorf("title slug = %q", slug)
+	}
+	options := outline[0].Children[0]
+	if len(options.Children) != 2 || options.Children[0].Slug != "-b---browse" {
+		t.Errorf("options entries = %+v", options.Children)
+	}
+	if again := outline[0].Children[1]; again.Slug != "options-1" || len(again.Children) != 1 {
+		t.Errorf("second options section = %+v", again)
+	}
+}
+
+func TestMandown_FrontMatter(t *testing.T) {
+	input := `---
+name: gzip # another name
+section: 1
+description: compress, or expand files
+version: 1.2,3
+aliases: [gunzip, zcat]
+tags: compression, archive
+see-also:
+  - tar(1)
+  - 'zip(1)'
+# a comment
+last-reviewed: 2014-03-01
+---
+# gzip(1) - compress files
+`
+	meta, body, err := SplitFrontMatter([]byte(input))
+	if err != nil {
+		t.Fatal("SplitFrontMatter returned error: ", err)
+	}
+	if string(body) != "# gzip(1) - compress files\n" {
+		t.Errorf("body = %q", body)
+	}
+	// Only lists are split at commas.
+	if meta.Name != "gzip" || meta.Section != "1" || meta.Description != "compress, or expand files" ||
+		meta.Version != "1.2,3" || meta.Reviewed != "2014-03-01" {
+		t.Errorf("meta = %+v", meta)
+	}
+	for _, l := range []struct {
+		got, want []string
+	}{
+		{meta.Aliases, []string{"gunzip", "zcat"}},
+		{meta.Tags, []string{"compression", "archive"}},
+		{meta.SeeAlso, []string{"tar(1)", "zip(1)"}},
+	} {
+		if strings.Join(l.got, "|") != strings.Join(l.want, "|") {
+			t.Errorf("list = %q, want %q", l.got, l.want)
+		}
+	}
+
+	// A rule that is not closed is not front matter.
+	input = "---\n# title\n"
+	if _, body, _ := SplitFrontMatter([]byte(input)); string(body) != input {
+		t.Errorf("unclosed front matter body = %q, want %q", body, input)
+	}
+
+	if _, _, err := SplitFrontMatter([]byte("---\nno colon\n---\n")); err == nil {
+		t.Error("malformed front matter gave no error")
+	}
+}
+
+func TestMandown_Tree(t *testing.T) {
+	input := "Intro text.\n\n# gman(1)\n## Options\n" +
+		"- one\n- two\n  1. nested\n\n" +
+		"```sh\nls -l\n```\n\n" +
+		"| Key | Value |\n|-----|-------|\n| a | 1 |\n\n" +
+		"> quoted\n\n## Options"
+
+	root := Parse([]byte(input)).Tree()
+	if len(root.Children) != 2 || root.Children[0].Kind != ParagraphNode || root.Children[0].Text != "Intro text." {
+		t.Fatalf("unexpected root children: %+v", root.Children)
+	}
+	title := root.Children[1]
+	if title.Kind != SectionNode || title.Level != 1 || len(title.Children) != 2 {
+		t.Fatalf("title section = %+v", title)
+	}
+	options := title.Children[0]
+	var kinds []NodeKind
+	for _, n := range options.Children {
+		kinds = append(kinds, n.Kind)
+	}
+	want := []NodeKind{ListNode, CodeNode, TableNode, QuoteNode}
+	if len(kinds) != len(want) {
+		t.Fatalf("options children kinds = %v, want %v", kinds, want)
+	}
+	for i := range want {
+		if kinds[i] != want[i] {
+			t.Errorf("options child %d kind = %v, want %v", i, kinds[i], want[i])
+		}
+	}
+	list := options.Children[0]
+	if len(list.Children) != 2 || list.Ordered {
+		t.Fatalf("list = %+v", list)
+	}
+	two := list.Children[1]
+	if len(two.Children) != 2 || two.Children[0].Text != "two" || two.Children[1].Kind != ListNode || !two.Children[1].Ordered {
+		t.Errorf("nested list item = %+v", two.Children)
+	}
+	if code := options.Children[1]; code.Info != "sh" || code.Text != "ls -l" {
+		t.Errorf("code = %+v", code)
+	}
+	if table := options.Children[2]; len(table.Rows) != 2 || table.Rows[1][1] != "1" {
+		t.Errorf("table rows = %q", table.Rows)
+	}
+	if again := title.Children[1]; again.Slug != "options-1" {
+		t.Errorf("second options slug = %q", again.Slug)
+	}
+}
+
+func TestMandown_Inline(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []Span
+	}{
+		{"a **bold** and *em*", []Span{{Plain, "a ", ""}, {Strong, "bold", ""}, {Plain, " and ", ""}, {Emphasis, "em", ""}}},
+		{"snake_case_name", []Span{{Plain, "snake_case_name", ""}}},
+		{"is ***both*** here", []Span{{Plain, "is ", ""}, {StrongEmphasis, "both", ""}, {Plain, " here", ""}}},
+		{"run `ls *.go` now", []Span{{Plain, "run ", ""}, {CodeSpan, "ls *.go", ""}, {Plain, " now", ""}}},
+		{"see [gzip(1)](gman://gzip.1)", []Span{{Plain, "see ", ""}, {Link, "gzip(1)", "gman://gzip.1"}}},
+		{"[zip](gman://zip(1))", []Span{{Link, "zip", "gman://zip(1)"}}},
+		{"![logo](logo.png)<br/>", []Span{{Image, "logo", "logo.png"}, {HTML, "<br/>", ""}}},
+		{`\*not em\*`, []Span{{Plain, "*not em*", ""}}},
+		{"<http://x.org>", []Span{{Link, "http://x.org", "http://x.org"}}},
+	}
+	for _, tt := range tests {
+		got := Inline(tt.input)
+		if len(got) != len(tt.want) {
+			t.Errorf("Inline(%q) = %+v, want %+v", tt.input, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("Inline(%q) span %d = %+v, want %+v", tt.input, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestMandown_ParseTitle(t *testing.T) {
+	tests := []struct {
+		title, name, section, description string
+		ok                                bool
+	}{
+		{"gman(1) - A better help system", "gman", "1", "A better help system", true},
+		{"gman-mandown(7) -- Gman manual markdown format", "gman-mandown", "7", "Gman manual markdown format", true},
+		{"gzip(1)", "gzip", "1", "", true},
+		{"Just a title", "", "", "", false},
+	}
+	for _, tt := range tests {
+		name, section, description, ok := ParseTitle(tt.title)
+		if name != tt.name || section != tt.section || description != tt.description || ok != tt.ok {
+			t.Errorf("ParseTitle(%q) = %q, %q, %q, %v, want %q, %q, %q, %v", tt.title,
+				name, section, description, ok, tt.name, tt.section, tt.description, tt.ok)
+		}
+	}
+}
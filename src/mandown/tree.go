@@ -0,0 +1,226 @@
+// Copyright 2014 The Gman Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in LICENSE file.
+
+package mandown
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// NodeKind is the kind of a node in a page tree.
+type NodeKind int
+
+const (
+	SectionNode   NodeKind = iota // a heading and the nodes below it
+	ParagraphNode                 // paragraph text
+	CodeNode                      // fenced or indented code
+	ListNode                      // bulleted or numbered list of items
+	ItemNode                      // list item
+	QuoteNode                     // block quote
+	TableNode                     // table
+	RuleNode                      // horizontal rule
+)
+
+// Node is a node in the tree of a page. Sections hold the nodes up to the
+// next heading of the same or a higher level, including the sections of
+// lower level headings; lists hold items; items and quotes hold the blocks
+// inside them.
+type Node struct {
+	Kind     NodeKind
+	Level    int        // heading level of a section; indent of an item
+	Title    string     // heading of a section, as inline Markdown
+	Slug     string     // anchor of a section, unique within the page
+	Text     string     // inline Markdown of a paragraph; code text
+	Info     string     // info string of fenced code, e.g. "sh"
+	Ordered  bool       // whether a list is numbered
+	Rows     [][]string // table cells as inline Markdown, header row first
+	Children []*Node
+}
+
+// tableRuleRe matches the line under a table header, such as "|---|:-:|".
+var tableRuleRe = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+
+// Tree returns the page as a tree. The root is a section of level 0 holding
+// the nodes before the first heading and the top level sections.
+func (doc *Doc) Tree() *Node {
+	root := &Node{Kind: SectionNode}
+	stack := []*Node{root}
+	slugs := make(map[string]int)
+	for _, b := range doc.Blocks {
+		parent := stack[len(stack)-1]
+		switch b.Kind {
+		case Heading:
+			for len(stack) > 1 && stack[len(stack)-1].Level >= b.Level {
+				stack = stack[:len(stack)-1]
+			}
+			sec := &Node{Kind: SectionNode, Level: b.Level, Title: b.Title, Slug: uniqueSlug(b.Title, slugs)}
+			stack[len(stack)-1].Children = append(stack[len(stack)-1].Children, sec)
+			stack = append(stack, sec)
+		case Code:
+			parent.Children = append(parent.Children, doc.codeNode(b))
+		case Rule:
+			parent.Children = append(parent.Children, &Node{Kind: RuleNode})
+		case ListItem:
+			addItem(parent, doc.itemNode(b))
+		case Text:
+			parent.Children = append(parent.Children, textNodes(doc.Lines[b.Start:b.End])...)
+		}
+	}
+	return root
+}
+
+// uniqueSlug returns the slug of title, numbered if used holds it already,
+// and records it in used.
+func uniqueSlug(title string, used map[string]int) string {
+	slug := Slug(title)
+	if n := used[slug]; n > 0 {
+		used[slug] = n + 1
+		return fmt.Sprintf("%s-%d", slug, n)
+	}
+	used[slug] = 1
+	return slug
+}
+
+// blocks returns the nodes of a nested piece of a page, such as the inside
+// of a list item or a quote.
+func blocks(lines []string) []*Node {
+	return Parse([]byte(strings.Join(lines, "\n"))).Tree().Children
+}
+
+// codeNode returns the code in block b without its fences or indentation.
+func (doc *Doc) codeNode(b Block) *Node {
+	lines := doc.Lines[b.Start:b.End]
+	var code []string
+	if marker := fenceMarker(lines[0]); marker != "" {
+		indent := len(lines[0]) - len(strings.TrimLeft(lines[0], " "))
+		end := len(lines)
+		if end > 1 && closesFence(lines[end-1], marker) {
+			end--
+		}
+		for _, line := range lines[1:end] {
+			code = append(code, trimIndent(line, indent))
+		}
+	} else {
+		for _, line := range lines {
+			if strings.HasPrefix(line, "\t") {
+				code = append(code, line[1:])
+			} else {
+				code = append(code, trimIndent(line, 4))
+			}
+		}
+	}
+	for len(code) > 0 && isBlank(code[len(code)-1]) {
+		code = code[:len(code)-1]
+	}
+	return &Node{Kind: CodeNode, Info: b.Info, Text: strings.Join(code, "\n")}
+}
+
+// trimIndent removes up to n leading spaces from line.
+func trimIndent(line string, n int) string {
+	i := 0
+	for i < n && i < len(line) && line[i] == ' ' {
+		i++
+	}
+	return line[i:]
+}
+
+// itemNode returns the list item in block b with the blocks inside it.
+func (doc *Doc) itemNode(b Block) *Node {
+	lines := doc.Lines[b.Start:b.End]
+	first := lines[0]
+	indent := len(first) - len(strings.TrimLeft(first, " "))
+	s := first[indent:]
+	ordered := s[0] >= '0' && s[0] <= '9'
+	marker := 1
+	if ordered {
+		marker = strings.IndexByte(s, '.') + 1
+	}
+	text := strings.TrimLeft(s[marker:], " \t")
+	content := indent + len(s) - len(text)
+	if text == "" {
+		content = indent + marker + 1
+	}
+
+	inner := []string{text}
+	for _, line := range lines[1:] {
+		if strings.HasPrefix(line, "\t") {
+			line = line[1:]
+		} else {
+			line = trimIndent(line, content)
+		}
+		inner = append(inner, line)
+	}
+	return &Node{Kind: ItemNode, Level: indent, Ordered: ordered, Children: blocks(inner)}
+}
+
+// addItem adds item to the list that ends parent, or to a new one. An item
+// indented more than the last one is nested in it.
+func addItem(parent *Node, item *Node) {
+	if n := len(parent.Children); n > 0 {
+		list := parent.Children[n-1]
+		if list.Kind == ListNode && len(list.Children) > 0 {
+			last := list.Children[len(list.Children)-1]
+			if item.Level > last.Level+1 {
+				addItem(last, item)
+				return
+			}
+			if list.Ordered == item.Ordered {
+				list.Children = append(list.Children, item)
+				return
+			}
+		}
+	}
+	parent.Children = append(parent.Children, &Node{Kind: ListNode, Ordered: item.Ordered, Children: []*Node{item}})
+}
+
+// textNodes splits the lines of a text block into paragraphs, quotes and
+// tables.
+func textNodes(lines []string) []*Node {
+	var nodes []*Node
+	var para []string
+	flush := func() {
+		if len(para) > 0 {
+			nodes = append(nodes, &Node{Kind: ParagraphNode, Text: strings.Join(para, "\n")})
+			para = nil
+		}
+	}
+	for i := 0; i < len(lines); {
+		line := strings.TrimSpace(lines[i])
+		switch {
+		case strings.HasPrefix(line, ">"):
+			flush()
+			var quoted []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				q := strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")
+				quoted = append(quoted, strings.TrimPrefix(q, " "))
+			}
+			nodes = append(nodes, &Node{Kind: QuoteNode, Children: blocks(quoted)})
+		case strings.Contains(line, "|") && i+1 < len(lines) && tableRuleRe.MatchString(lines[i+1]):
+			flush()
+			table := &Node{Kind: TableNode, Rows: [][]string{tableCells(line)}}
+			for i += 2; i < len(lines) && strings.Contains(lines[i], "|"); i++ {
+				table.Rows = append(table.Rows, tableCells(lines[i]))
+			}
+			nodes = append(nodes, table)
+		default:
+			para = append(para, line)
+			i++
+		}
+	}
+	flush()
+	return nodes
+}
+
+// tableCells returns the cells of a table row.
+func tableCells(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimSuffix(strings.TrimPrefix(line, "|"), "|")
+	var cells []string
+	for _, cell := range strings.Split(line, "|") {
+		cells = append(cells, strings.TrimSpace(cell))
+	}
+	return cells
+}
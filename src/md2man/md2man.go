@@ -0,0 +1,324 @@
+// Copyright 2014 The Gman Authors. All rights reserved.
+// Use of this source code is governed by an MIT-style
+// license that can be found in LICENSE file.
+
+// md2man
+// Package for converting Mandown (gman Markdown) pages to man (*roff) pages.
+
+package md2man
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"mandown"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// gmanLinkRe matches a link to another page, such as gman://gzip.1,
+// gman://gzip(1) or gman://gzip.
+var gmanLinkRe = regexp.MustCompile(`^gman://([^/()]+?)(?:\.([0-9][a-z0-9]*)|\(([^()]+)\))?/?$`)
+
+// manuals are the titles of the manuals of the standard sections, as man
+// pages give them in the .TH line.
+var manuals = map[byte]string{
+	'1': "General Commands Manual",
+	'2': "System Calls Manual",
+	'3': "Library Functions Manual",
+	'4': "Kernel Interfaces Manual",
+	'5': "File Formats Manual",
+	'6': "Games Manual",
+	'7': "Miscellaneous Information Manual",
+	'8': "System Manager's Manual",
+	'9': "Kernel Developer's Manual",
+}
+
+// Header is what the .TH line of a man page says about it:
+//
+//	.TH NAME SECTION DATE SOURCE MANUAL
+//
+// The name and section, when empty, are taken from the title heading of
+// the page, and the manual from the section.
+type Header struct {
+	Name    string
+	Section string
+	Date    string // date of the last change, such as 2014-03-01
+	Source  string // the software documented, such as "gzip 1.6"
+	Manual  string // title of the manual
+}
+
+// Convert reads a Mandown page and writes it as a man page.
+func Convert(reader io.Reader, writer io.Writer) error {
+	input, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	return Write(writer, mandown.Parse(input), Header{})
+}
+
+// Write writes a scanned page as a man page. The title heading, the first
+// level one heading, is replaced by the .TH line and a NAME section giving
+// its description.
+func Write(writer io.Writer, doc *mandown.Doc, header Header) error {
+	w := &roffWriter{w: bufio.NewWriter(writer)}
+	w.page(doc.Tree(), header)
+	return w.w.Flush()
+}
+
+// roffWriter writes a page tree as roff requests.
+type roffWriter struct {
+	w *bufio.Writer
+}
+
+// page writes the nodes of the root section of a page tree, after the .TH
+// line.
+func (w *roffWriter) page(root *mandown.Node, header Header) {
+	nodes := root.Children
+	var title *mandown.Node
+	for i, n := range nodes {
+		if n.Kind == mandown.SectionNode {
+			if n.Level == 1 {
+				title = n
+				nodes = append(append(nodes[:i:i], n.Children...), nodes[i+1:]...)
+			}
+			break
+		}
+	}
+	var name, description string
+	if title != nil {
+		text := mandown.PlainText(mandown.Inline(title.Title))
+		name = text
+		if n, section, desc, ok := mandown.ParseTitle(text); ok {
+			name, description = n, desc
+			if header.Section == "" {
+				header.Section = section
+			}
+		}
+		if header.Name == "" {
+			header.Name = name
+		}
+	}
+	if header.Section == "" {
+		header.Section = "7"
+	}
+	if header.Manual == "" {
+		header.Manual = manuals[header.Section[0]]
+	}
+	fields := []string{strings.ToUpper(header.Name), header.Section, header.Date, header.Source, header.Manual}
+	for len(fields) > 2 && fields[len(fields)-1] == "" {
+		fields = fields[:len(fields)-1]
+	}
+	th := ".TH"
+	for _, field := range fields {
+		th += " " + quote(strings.Replace(field, `\`, `\e`, -1))
+	}
+	w.line(th)
+	if description != "" {
+		w.line(".SH NAME")
+		w.line(escape(name) + ` \- ` + escape(description))
+	}
+	w.nodes(nodes)
+}
+
+// nodes writes a run of nodes.
+func (w *roffWriter) nodes(nodes []*mandown.Node) {
+	for _, n := range nodes {
+		w.node(n)
+	}
+}
+
+// node writes a node and the nodes inside it.
+func (w *roffWriter) node(n *mandown.Node) {
+	switch n.Kind {
+	case mandown.SectionNode:
+		switch {
+		case n.Level <= 2:
+			w.line(".SH " + quote(w.inline(strings.ToUpper(n.Title))))
+		case n.Level == 3:
+			w.line(".SS " + quote(w.inline(n.Title)))
+		default:
+			// An option or other definition entry.
+			w.line(".TP")
+			w.line(guard(w.tag(n.Title)))
+			w.item(n)
+			return
+		}
+		w.nodes(n.Children)
+	case mandown.ParagraphNode:
+		if text := w.inline(n.Text); strings.TrimSpace(text) != "" {
+			w.line(".PP")
+			w.text(text)
+		}
+	case mandown.CodeNode:
+		w.line(".PP")
+		w.line(".RS 4")
+		w.line(".nf")
+		for _, line := range strings.Split(n.Text, "\n") {
+			w.line(escapeLine(line))
+		}
+		w.line(".fi")
+		w.line(".RE")
+	case mandown.ListNode:
+		for i, item := range n.Children {
+			if n.Ordered {
+				w.line(".IP " + strconv.Itoa(i+1) + ". 4")
+			} else {
+				w.line(`.IP \(bu 2`)
+			}
+			w.item(item)
+		}
+	case mandown.QuoteNode:
+		w.line(".RS 4")
+		w.nodes(n.Children)
+		w.line(".RE")
+	case mandown.TableNode:
+		w.table(n.Rows)
+	case mandown.RuleNode:
+		w.line(".PP")
+	}
+}
+
+// table writes a table for tbl(1), its header row in bold and underlined.
+func (w *roffWriter) table(rows [][]string) {
+	columns := 0
+	for _, row := range rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+	w.line(".PP")
+	w.line(".TS")
+	w.line(strings.TrimSpace(strings.Repeat("lB ", columns)))
+	w.line(strings.TrimSpace(strings.Repeat("l ", columns)) + ".")
+	for i, row := range rows {
+		var cells []string
+		for _, cell := range row {
+			cells = append(cells, w.inline(cell))
+		}
+		w.line(guard(strings.Join(cells, "\t")))
+		if i == 0 {
+			w.line("_")
+		}
+	}
+	w.line(".TE")
+}
+
+// item writes the blocks of a list item or definition entry after its .IP
+// or .TP line. The first paragraph follows the tag directly; the blocks
+// after it are indented.
+func (w *roffWriter) item(item *mandown.Node) {
+	children := item.Children
+	if len(children) > 0 && children[0].Kind == mandown.ParagraphNode {
+		w.text(w.inline(children[0].Text))
+		children = children[1:]
+	}
+	if len(children) == 0 {
+		return
+	}
+	w.line(".RS")
+	w.nodes(children)
+	w.line(".RE")
+}
+
+// inline converts inline Markdown to roff text with font changes.
+func (w *roffWriter) inline(text string) string {
+	var b strings.Builder
+	for _, s := range mandown.Inline(text) {
+		b.WriteString(span(s))
+	}
+	return b.String()
+}
+
+// tag converts the heading of a definition entry, such as
+// "-o *file*, --output=*file*", with the words of plain text, such as
+// option names, in bold.
+func (w *roffWriter) tag(text string) string {
+	var b strings.Builder
+	for _, s := range mandown.Inline(text) {
+		if s.Kind == mandown.Plain {
+			b.WriteString(tagWordRe.ReplaceAllStringFunc(s.Text, func(word string) string {
+				return `\fB` + escape(word) + `\fR`
+			}))
+		} else {
+			b.WriteString(span(s))
+		}
+	}
+	return b.String()
+}
+
+// tagWordRe matches a word of a definition entry heading.
+var tagWordRe = regexp.MustCompile(`[^\s,|\[\]{}]+`)
+
+// span converts a span of inline text to roff. A link to another page
+// becomes a cross reference such as \fBgzip\fR(1), and any other link shows
+// its target after the text.
+func span(s mandown.Span) string {
+	switch s.Kind {
+	case mandown.Strong, mandown.CodeSpan:
+		return `\fB` + escape(s.Text) + `\fR`
+	case mandown.StrongEmphasis:
+		return `\f(BI` + escape(s.Text) + `\fR`
+	case mandown.Emphasis:
+		return `\fI` + escape(s.Text) + `\fR`
+	case mandown.Link:
+		if m := gmanLinkRe.FindStringSubmatch(s.URL); m != nil {
+			name, section := m[1], m[2]+m[3]
+			ref := `\fB` + escape(name) + `\fR`
+			if section != "" {
+				ref += "(" + escape(section) + ")"
+			}
+			if s.Text == name || s.Text == name+"("+section+")" {
+				return ref
+			}
+			return escape(s.Text) + " (" + ref + ")"
+		}
+		if s.URL == s.Text {
+			return escape(s.Text)
+		}
+		return escape(s.Text) + ` <` + escape(s.URL) + `>`
+	case mandown.HTML:
+		return ""
+	}
+	return escape(s.Text)
+}
+
+// text writes lines of converted text, guarding lines that would be read
+// as requests.
+func (w *roffWriter) text(text string) {
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			w.line(guard(line))
+		}
+	}
+}
+
+// line writes a line of output.
+func (w *roffWriter) line(s string) {
+	w.w.WriteString(s)
+	w.w.WriteByte('\n')
+}
+
+// escape escapes the characters roff treats specially in text.
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+}
+
+// escapeLine escapes a line of code, which is written as it is.
+func escapeLine(s string) string {
+	return guard(escape(s))
+}
+
+// guard keeps a line starting with "." or "'" from being read as a request.
+func guard(line string) string {
+	if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+		return `\&` + line
+	}
+	return line
+}
+
+// quote quotes a request argument.
+func quote(s string) string {
+	return `"` + strings.Replace(s, `"`, `\(dq`, -1) + `"`
+}
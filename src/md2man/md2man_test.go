@@ -0,0 +1,66 @@
+package md2man
+
+import (
+	"bytes"
+	"mandown"
+	"strings"
+	"testing"
+)
+
+func TestMd2man_Convert(t *testing.T) {
+	input := "# gman(1) - A better help system\n\n## Options\n" +
+		"Use **bold**, *italic* and `code`.\n.starts with a dot\n\n" +
+		"```sh\ngman -s Summary tar\n```\n\n- one\n- two\n"
+
+	var out bytes.Buffer
+	if err := Convert(strings.NewReader(input), &out); err != nil {
+		t.Fatal("md2man returned error: ", err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		".TH \"GMAN\" \"1\" \"\" \"\" \"General Commands Manual\"\n.SH NAME\ngman \\- A better help system\n",
+		".SH \"OPTIONS\"\n.PP\nUse \\fBbold\\fR, \\fIitalic\\fR and \\fBcode\\fR.\n\\&.starts with a dot\n",
+		".nf\ngman \\-s Summary tar\n.fi\n",
+		".IP \\(bu 2\none\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output lacks %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestMd2man_Write(t *testing.T) {
+	input := `Gzip(1) -- compress files
+=========================
+
+## Options
+#### -S *suf*, --suffix=*suf*
+Use suffix *suf*.
+
+More about it.
+
+## Levels
+| Level | Speed |
+|-------|-------|
+| 1     | fast  |
+
+## See also
+[tar(1)](gman://tar.1), [the zip page](gman://zip(1)) and [home](http://gzip.org).
+`
+	var out bytes.Buffer
+	header := Header{Name: "gzip", Date: "2014-03-01", Source: "gzip 1.6"}
+	if err := Write(&out, mandown.Parse([]byte(input)), header); err != nil {
+		t.Fatal("md2man returned error: ", err)
+	}
+	got := out.String()
+	for _, want := range []string{
+		".TH \"GZIP\" \"1\" \"2014-03-01\" \"gzip 1.6\" \"General Commands Manual\"\n.SH NAME\nGzip \\- compress files\n",
+		".TP\n\\fB\\-S\\fR \\fIsuf\\fR, \\fB\\-\\-suffix=\\fR\\fIsuf\\fR\nUse suffix \\fIsuf\\fR.\n.RS\n.PP\nMore about it.\n.RE\n",
+		".TS\nlB lB\nl l.\nLevel\tSpeed\n_\n1\tfast\n.TE\n",
+		"\\fBtar\\fR(1), the zip page (\\fBzip\\fR(1)) and home <http://gzip.org>.\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output lacks %q:\n%s", want, got)
+		}
+	}
+}